@@ -0,0 +1,145 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/deckarep/gorganize/file_management/rules"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	applyOptions rules.Options
+	applyUndo    bool
+)
+
+func init() {
+	applyCmd.Flags().StringVarP(&applyOptions.Dest, "dest", "o", "", "--dest is where relative rule destinations point, overriding the rules file")
+	applyCmd.Flags().BoolVarP(&applyOptions.DryRun, "dry-run", "n", false, "--dry-run lists what every rule would do without touching anything")
+	applyCmd.Flags().StringVarP(&applyOptions.Journal, "journal", "j", "gorganize-apply.journal", "--journal is the undo journal to record actions in")
+	applyCmd.Flags().StringVar(&applyOptions.Trash, "trash", "", "--trash is the folder deleted files are moved into, defaults to the journal's path with .trash appended")
+	applyCmd.Flags().BoolVar(&applyUndo, "undo", false, "--undo reverts the actions recorded in --journal")
+	addCollisionFlag(applyCmd)
+	RootCmd.AddCommand(applyCmd)
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply [rules file] [source folder(s) ...]",
+	Short: "organizes files by the rules of a rules file",
+	Long: `apply [rules file] [source folder(s) ...] runs every file below the source
+folders, or the sources of the rules file, through its rules in order.
+
+Each [[rule]] matches files by category or glob (match, exclude), size
+(min-size, max-size), capture date (after, before, taken) and camera model
+(camera), then will copy, move, rename, extract, delete or tag them. Destinations
+(dest, filename) are templates taking the same tokens as rename. The first
+matching rule wins unless it sets continue = true.
+
+	dest = "library"
+
+	[[rule]]
+	name = "photos"
+	match = ["image"]
+	taken = "2016"
+	action = "move"
+	dest = "photos/{date:2006}/{date:01}"
+
+Actions are recorded in --journal so a run can be reverted with --undo. Deleted
+files are kept in --trash until it is emptied by hand.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if applyUndo {
+			if err := rules.Undo(rootCtx, applyOptions.Journal, applyOptions); err != nil {
+				checkInterrupted()
+				logrus.Fatal("Couldn't undo apply: ", err)
+			}
+			return
+		}
+
+		if len(args) < 1 {
+			logrus.Fatal("apply requires a [rules file]")
+		}
+		rs, err := rules.Load(nil, args[0])
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		applyOptions.Collision = collisionPolicy()
+		reporter, stop := startProgress()
+		applyOptions.Progress = reporter
+		result, err := rules.Apply(rootCtx, rs, args[1:], applyOptions)
+		stop()
+		for _, o := range result.Outcomes {
+			emitOutcome(o)
+		}
+		if applyOptions.DryRun {
+			logrus.Info("Dry run, nothing was changed")
+		}
+		finishRun(applySummary("apply", result.Stats()))
+		checkInterrupted()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	},
+}
+
+// applyRecord is what a rule did with a file.
+type applyRecord struct {
+	Type    string   `json:"type"`
+	Rule    string   `json:"rule"`
+	Action  string   `json:"action"`
+	Src     string   `json:"src"`
+	Dst     string   `json:"dst,omitempty"`
+	Result  string   `json:"result"`
+	Tags    []string `json:"tags,omitempty"`
+	Written int      `json:"written,omitempty"`
+	Bytes   int64    `json:"bytes"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// emitOutcome emits a record per outcome, in text mode only a dry run lists
+// them.
+func emitOutcome(o rules.Outcome) {
+	text := ""
+	if applyOptions.DryRun {
+		text = fmt.Sprintf("%-7s %s", o.Action, o.Src)
+		switch {
+		case o.Dst != "":
+			text += " -> " + o.Dst
+		case len(o.Tags) > 0:
+			text += fmt.Sprintf(" %v", o.Tags)
+		}
+	}
+	emit(applyRecord{
+		Type:    "apply",
+		Rule:    o.Rule,
+		Action:  string(o.Action),
+		Src:     o.Src,
+		Dst:     o.Dst,
+		Result:  string(o.Result),
+		Tags:    o.Tags,
+		Written: len(o.Written),
+		Bytes:   o.Bytes,
+		Error:   errorString(o.Err),
+	}, text)
+}
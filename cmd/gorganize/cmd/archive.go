@@ -0,0 +1,265 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/archive"
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	archiveFormat        string
+	archiveCharsetName   string
+	archiveCharset       archive.Charset
+	archiveFilter        op.Filter
+	archiveCreateOptions archive.CreateOptions
+)
+
+func init() {
+	archiveCmd.PersistentFlags().StringVarP(&archiveFormat, "format", "f", "", "--format is either table or json")
+	archiveCmd.PersistentFlags().MarkDeprecated("format", "use --output text or --output json instead")
+	archiveCmd.PersistentFlags().StringVar(&archiveCharsetName, "charset", "cp437", "--charset decodes entry names that aren't UTF-8: "+strings.Join(archive.CharsetNames(), ", "))
+	archiveCreateCmd.Flags().StringSliceVarP(&archiveFilter.Include, "include", "i", nil, "--include only adds files matching these globs")
+	archiveCreateCmd.Flags().StringSliceVarP(&archiveFilter.Exclude, "exclude", "e", nil, "--exclude skips files and folders matching these globs")
+	archiveCreateCmd.Flags().Int64Var(&archiveCreateOptions.MaxSize, "max-size", 0, "--max-size splits the archive into volumes of at most this many bytes")
+	archiveCreateCmd.Flags().BoolVar(&archiveCreateOptions.Manifest, "manifest", true, "--manifest embeds a MANIFEST.md5 recipients can verify with archive test")
+
+	archiveCmd.AddCommand(archiveListCmd, archiveTestCmd, archiveCreateCmd)
+	RootCmd.AddCommand(archiveCmd)
+}
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "archive creates and inspects archives without extracting them",
+}
+
+// archiveEntry is the JSON shape of a listed or tested entry.
+type archiveEntry struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Size       int64     `json:"size"`
+	Compressed int64     `json:"compressed,omitempty"`
+	Ratio      float64   `json:"ratio,omitempty"`
+	CRC32      string    `json:"crc32,omitempty"`
+	Modified   time.Time `json:"modified"`
+	OK         *bool     `json:"ok,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func newArchiveEntry(hdr *archive.Header) archiveEntry {
+	name := hdr.Name
+	if hdr.NonUTF8 {
+		name = archiveCharset.Decode(name)
+	}
+	e := archiveEntry{
+		Name:       name,
+		Type:       entryTypeName(hdr.Type),
+		Size:       hdr.Size,
+		Compressed: hdr.CompressedSize,
+		Ratio:      hdr.Ratio(),
+		Modified:   hdr.ModTime,
+	}
+	if hdr.HasCRC {
+		e.CRC32 = fmt.Sprintf("%08x", hdr.CRC32)
+	}
+	return e
+}
+
+func entryTypeName(t archive.EntryType) string {
+	switch t {
+	case archive.TypeDir:
+		return "dir"
+	case archive.TypeSymlink:
+		return "symlink"
+	case archive.TypeOther:
+		return "other"
+	}
+	return "file"
+}
+
+func printArchiveEntries(entries []archiveEntry, withStatus bool) {
+	if outputFlag != outputText {
+		for _, e := range entries {
+			emit(e, "")
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	header := "NAME\tSIZE\tCOMPRESSED\tRATIO\tCRC32\tMODIFIED"
+	if withStatus {
+		header += "\tSTATUS"
+	}
+	fmt.Fprintln(w, header)
+	for _, e := range entries {
+		size, compressed, ratio, crc := "-", "-", "-", "-"
+		if e.Size >= 0 {
+			size = fmt.Sprint(e.Size)
+		}
+		if e.Compressed > 0 {
+			compressed = fmt.Sprint(e.Compressed)
+		}
+		if e.Ratio > 0 {
+			ratio = fmt.Sprintf("%.2f", e.Ratio)
+		}
+		if e.CRC32 != "" {
+			crc = e.CRC32
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s", e.Name, size, compressed, ratio, crc,
+			e.Modified.Format("2006-01-02 15:04:05"))
+		if withStatus {
+			status := "ok"
+			if e.Error != "" {
+				status = e.Error
+			}
+			fmt.Fprintf(w, "\t%s", status)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
+
+func checkArchiveFormat() {
+	// --format predates --output and maps onto it.
+	switch archiveFormat {
+	case "":
+	case "table":
+		outputFlag = outputText
+	case "json":
+		outputFlag = outputJSON
+	default:
+		logrus.Fatalf("Unknown --format: %s, expected table or json", archiveFormat)
+	}
+
+	var err error
+	if archiveCharset, err = archive.LookupCharset(archiveCharsetName); err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+var archiveListCmd = &cobra.Command{
+	Use:   "list [archive]",
+	Short: "lists the entries of an archive",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkArchiveFormat()
+		if len(args) != 1 {
+			logrus.Fatal("archive list requires an [archive]")
+		}
+
+		headers, _, err := archive.List(rootCtx, vfs.OS, args[0])
+		if err != nil {
+			checkInterrupted()
+			logrus.Fatal(err)
+		}
+
+		entries := make([]archiveEntry, 0, len(headers))
+		for _, hdr := range headers {
+			entries = append(entries, newArchiveEntry(hdr))
+		}
+		printArchiveEntries(entries, false)
+	},
+}
+
+var archiveTestCmd = &cobra.Command{
+	Use:   "test [archive]",
+	Short: "reads every entry of an archive and verifies its CRC",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkArchiveFormat()
+		if len(args) != 1 {
+			logrus.Fatal("archive test requires an [archive]")
+		}
+
+		results, _, err := archive.Test(rootCtx, vfs.OS, args[0])
+
+		failed := 0
+		entries := make([]archiveEntry, 0, len(results))
+		for _, result := range results {
+			e := newArchiveEntry(result.Header)
+			if !result.HasCRC && result.Type == archive.TypeFile {
+				// Formats without a stored CRC still get one computed.
+				e.CRC32 = fmt.Sprintf("%08x", result.Checksum)
+			}
+			ok := result.OK()
+			e.OK = &ok
+			if !ok {
+				e.Error = result.Err.Error()
+				failed++
+			}
+			entries = append(entries, e)
+		}
+		printArchiveEntries(entries, true)
+
+		if err != nil {
+			checkInterrupted()
+			logrus.Fatal(err)
+		}
+		if failed > 0 {
+			logrus.Fatalf("%d of %d entries failed", failed, len(results))
+		}
+	},
+}
+
+var archiveCreateCmd = &cobra.Command{
+	Use:   "create [archive] [file(s)|directories(s) ...]",
+	Short: "packs files and folders into a zip or tar.gz archive",
+	Long: `create [archive] [file(s)|directories(s) ...] packs the selected files into a .zip or .tar.gz archive.
+
+Already compressed media such as jpg or mp4 is stored in zips without being
+compressed again. Folders keep their name inside the archive.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			logrus.Fatal("archive create requires an [archive] and at least one file or directory")
+		}
+
+		var sources []archive.Source
+		for _, root := range args[1:] {
+			err := op.WalkFiles(vfs.OS, root, archiveFilter, func(path string, info os.FileInfo) error {
+				name, err := archive.EntryName(root, path)
+				if err != nil {
+					return err
+				}
+				sources = append(sources, archive.Source{Path: path, Name: name, Info: info})
+				return nil
+			})
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+		if len(sources) == 0 {
+			logrus.Fatal("No files selected")
+		}
+
+		if _, err := archive.Create(rootCtx, args[0], sources, archiveCreateOptions); err != nil {
+			checkInterrupted()
+			logrus.Fatal(err)
+		}
+	},
+}
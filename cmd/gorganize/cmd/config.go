@@ -0,0 +1,152 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/deckarep/gorganize/file_management/config"
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// appConfig is the configuration in effect, profile applied.
+var appConfig = config.New()
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+	RootCmd.AddCommand(configCmd)
+}
+
+// commandName is the path of cmd without the program name, as config files
+// key it.
+func commandName(cmd *cobra.Command) string {
+	return strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+}
+
+// loadConfig reads the config files, selects --profile and sets every flag of
+// cmd that wasn't given on the command line to its configured value.
+func loadConfig(cmd *cobra.Command) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = "."
+	}
+	c, err := config.Load(vfs.OS, config.Paths(cwd))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if profileFlag != "" {
+		if c, err = c.WithProfile(profileFlag); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	appConfig = c
+
+	for name, extensions := range c.Categories {
+		if err := op.AddCategory(name, extensions); err != nil {
+			logrus.Fatal("config: ", err)
+		}
+	}
+
+	own := c.Commands[commandName(cmd)]
+	flags := c.Flags(commandName(cmd))
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			// Top level defaults only apply to commands having the flag.
+			if _, ok := own[name]; ok {
+				logrus.Warnf("config: %s has no --%s flag", commandName(cmd), name)
+			}
+			continue
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := flag.Value.Set(config.FlagValue(flags[name])); err != nil {
+			logrus.Fatalf("config: invalid value for --%s: %s", name, err)
+		}
+	}
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "config inspects the configuration files",
+	Long: `config inspects the configuration files.
+
+Configuration is read from $XDG_CONFIG_HOME/gorganize/config.toml, falling back
+to ~/.config/gorganize/config.toml, and then from every .gorganize.toml between
+the root of the filesystem and the current directory, nearer files winning.
+Flags given on the command line always override configured values.`,
+}
+
+// configRecord is the JSON shape of config show.
+type configRecord struct {
+	Type    string                 `json:"type"`
+	Sources []string               `json:"sources"`
+	Profile string                 `json:"profile,omitempty"`
+	Config  map[string]interface{} `json:"config"`
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "prints the effective configuration merged from every config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		doc := appConfig.Doc()
+		sources := appConfig.Sources
+		if sources == nil {
+			sources = []string{}
+		}
+
+		var buf bytes.Buffer
+		if len(sources) == 0 {
+			fmt.Fprintln(&buf, "# No config files found.")
+		}
+		for _, source := range sources {
+			fmt.Fprintf(&buf, "# Loaded from %s\n", source)
+		}
+		if profileFlag != "" {
+			fmt.Fprintf(&buf, "# Profile %s applied.\n", profileFlag)
+		}
+		if len(doc) > 0 {
+			fmt.Fprintln(&buf)
+			if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+				logrus.Fatal(err)
+			}
+		}
+
+		emit(configRecord{Type: "config", Sources: sources, Profile: profileFlag, Config: doc},
+			strings.TrimSuffix(buf.String(), "\n"))
+	},
+}
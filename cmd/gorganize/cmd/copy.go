@@ -22,6 +22,8 @@ SOFTWARE.
 package cmd
 
 import (
+	"time"
+
 	"github.com/deckarep/gorganize/file_management/op"
 
 	"github.com/sirupsen/logrus"
@@ -33,10 +35,28 @@ var (
 	destFile   string
 )
 
+var collisionName string
+
 func init() {
+	addCollisionFlag(copyCmd)
 	RootCmd.AddCommand(copyCmd)
 }
 
+// addCollisionFlag registers --collision on cmd.
+func addCollisionFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&collisionName, "collision", string(op.CollisionRename),
+		"--collision is rename, skip or overwrite, what to do when a different file already has the destination name")
+}
+
+// collisionPolicy validates --collision.
+func collisionPolicy() op.Collision {
+	policy, err := op.ParseCollision(collisionName)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return policy
+}
+
 var copyCmd = &cobra.Command{
 	Use:   "copy [file(s)|directories(s) ...]",
 	Short: "copies one or more files",
@@ -45,9 +65,16 @@ var copyCmd = &cobra.Command{
 		if len(args) != 2 {
 			logrus.Fatal("You must provide a source file and destination file argument")
 		}
-		err := op.CopyFile(args[0], args[1])
+		start := time.Now()
+		reporter, stop := startProgress()
+		fr, err := op.CopyFile(rootCtx, args[0], args[1], op.Options{Progress: reporter, Collision: collisionPolicy()})
+		stop()
+		emitFile(fr)
+		result := op.Result{Files: []op.FileResult{fr}, Elapsed: time.Since(start)}
+		finishRun(opSummary("copy", result.Stats()))
+		checkInterrupted()
 		if err != nil {
-			logrus.Fatal("Error copying files")
+			logrus.Fatal("Error copying files: ", err)
 		}
 	},
 }
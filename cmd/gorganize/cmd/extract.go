@@ -0,0 +1,109 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/deckarep/gorganize/file_management/archive"
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/deckarep/gorganize/file_management/unzip"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	extractOptions = unzip.Options{Limits: unzip.DefaultLimits}
+	extractLayout  string
+	extractOnly    []string
+	extractCharset string
+)
+
+func init() {
+	extractCmd.Flags().StringVarP(&extractOptions.Dest, "dest", "o", "", "--dest is the folder to extract into, defaults to the folder being scanned or holding the archive")
+	extractCmd.Flags().StringVar(&extractLayout, "layout", string(unzip.LayoutPerArchive), "--layout is one of per-archive, alongside or merged")
+	extractCmd.Flags().Int64Var(&extractOptions.Limits.MaxBytes, "max-bytes", extractOptions.Limits.MaxBytes, "--max-bytes caps the total uncompressed size of an archive, 0 disables")
+	extractCmd.Flags().IntVar(&extractOptions.Limits.MaxEntries, "max-entries", extractOptions.Limits.MaxEntries, "--max-entries caps the number of entries in an archive, 0 disables")
+	extractCmd.Flags().Float64Var(&extractOptions.Limits.MaxRatio, "max-ratio", extractOptions.Limits.MaxRatio, "--max-ratio caps the compression ratio of any entry, 0 disables")
+	extractCmd.Flags().IntVar(&extractOptions.RecursiveDepth, "recursive-depth", 0, "--recursive-depth also extracts archives found inside archives, up to N levels deep")
+	extractCmd.Flags().StringSliceVar(&extractOnly, "only", nil, "--only extracts entries matching these globs or categories ("+strings.Join(op.CategoryNames(), ", ")+")")
+	extractCmd.Flags().BoolVar(&extractOptions.Flatten, "flatten", false, "--flatten writes entries straight into the destination without their folders")
+	extractCmd.Flags().BoolVarP(&extractOptions.KeepGoing, "keep-going", "k", false, "--keep-going skips entries that fail instead of rolling back their whole archive, unsafe entries still roll it back")
+	extractCmd.Flags().StringVar(&extractCharset, "charset", "cp437", "--charset decodes entry names that aren't UTF-8: "+strings.Join(archive.CharsetNames(), ", "))
+	addCollisionFlag(extractCmd)
+	RootCmd.AddCommand(extractCmd)
+}
+
+var extractCmd = &cobra.Command{
+	Use:     "extract [file(s)|directories(s) ...]",
+	Aliases: []string{"unzip"},
+	Short:   "uncompresses one or more archives",
+	Long: `extract [file(s)|directories(s) ...] will extract one or more archives or directories of archives recursively.
+
+Archives are recognized by content: zip, tar, tar.gz, tar.bz2 as well as single
+gzip or bzip2 compressed files.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		layout, err := unzip.ParseLayout(extractLayout)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		extractOptions.Layout = layout
+
+		if extractOptions.Only, err = op.ParseSelection(extractOnly); err != nil {
+			logrus.Fatal(err)
+		}
+		if extractOptions.Charset, err = archive.LookupCharset(extractCharset); err != nil {
+			logrus.Fatal(err)
+		}
+
+		extractOptions.Collision = collisionPolicy()
+		reporter, stop := startProgress()
+		extractOptions.Progress = reporter
+
+		var stats unzip.Stats
+		for _, file := range args {
+			result, err := unzip.All(rootCtx, file, extractOptions)
+			emitArchives(result)
+			stats = stats.Add(result.Stats())
+			if rootCtx.Err() != nil {
+				break
+			}
+			if err != nil {
+				logrus.Fatal(err)
+			}
+
+			failed := result.FailedEntries()
+			if result.FailedArchives() > 0 || len(failed) > 0 {
+				logrus.Errorf("%d archive(s) failed, %d entries failed", result.FailedArchives(), len(failed))
+				for _, e := range failed {
+					logrus.Error(e.Error())
+				}
+			}
+		}
+		stop()
+		finishRun(unzipSummary(stats))
+		checkInterrupted()
+		if stats.Failed > 0 {
+			logrus.Fatalf("%d archive(s) couldn't be extracted", stats.Failed)
+		}
+	},
+}
@@ -0,0 +1,106 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/catalog"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var findLong bool
+
+func init() {
+	findCmd.Flags().BoolVarP(&findLong, "long", "l", false, "--long lists size, capture date, type and camera alongside the paths")
+	RootCmd.AddCommand(findCmd)
+}
+
+var findCmd = &cobra.Command{
+	Use:   "find [query ...]",
+	Short: "find searches the catalog built by index",
+	Long: `find [query ...] lists the files in --catalog matching every term of the query,
+without reading the indexed drives.
+
+	gorganize find type:image camera:"NIKON D750" taken:2016 'size>5MB'
+
+Keys are type, ext, name, path, camera, tag, hash, size, taken and modified.
+Size, taken and modified also compare with >, >=, < and <=. A word without a key
+matches the file name, a leading - negates a term. Every argument is a single
+term, quote terms holding spaces, > or < so the shell leaves them alone, and put
+-- before the query when it starts with -.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		q, err := catalog.ParseTerms(args)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		found := openCatalog().Find(q)
+
+		if outputFlag != outputText {
+			for _, e := range found {
+				emit(findRecord{
+					Type:    "found",
+					Path:    e.Path,
+					Size:    e.Size,
+					ModTime: e.ModTime,
+					MD5:     e.MD5,
+					Kind:    e.Type,
+					Taken:   e.Taken,
+					Camera:  e.Camera,
+					Tags:    e.Tags,
+				}, "")
+			}
+			return
+		}
+
+		if !findLong {
+			for _, e := range found {
+				fmt.Println(e.Path)
+			}
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SIZE\tTAKEN\tTYPE\tCAMERA\tPATH")
+		for _, e := range found {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				formatBytes(e.Size), e.Taken.Format("2006-01-02 15:04:05"), e.Type, e.Camera, e.Path)
+		}
+		w.Flush()
+	},
+}
+
+// findRecord is a catalog entry matching the query.
+type findRecord struct {
+	Type    string    `json:"type"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	MD5     string    `json:"md5"`
+	Kind    string    `json:"kind"`
+	Taken   time.Time `json:"taken"`
+	Camera  string    `json:"camera,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+}
@@ -22,17 +22,31 @@ SOFTWARE.
 package cmd
 
 import (
+	"strings"
+
 	"github.com/deckarep/golang-set"
+	"github.com/deckarep/gorganize/file_management/archive"
 	"github.com/deckarep/gorganize/file_management/op"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var (
-//TODO: extensions flag
+	flattenCategories []string
+	flattenArchives   bool
+	flattenLimits     = archive.DefaultLimits
+	flattenCharset    string
 )
 
 func init() {
+	flattenCmd.Flags().StringSliceVarP(&flattenCategories, "category", "c", []string{"image"},
+		"--category selects the file types to flatten: "+strings.Join(op.CategoryNames(), ", "))
+	flattenCmd.Flags().BoolVarP(&flattenArchives, "archives", "a", false, "--archives copies matching files straight out of archives found in source folder")
+	flattenCmd.Flags().Int64Var(&flattenLimits.MaxBytes, "max-bytes", flattenLimits.MaxBytes, "--max-bytes caps the total uncompressed size read from an archive, 0 disables")
+	flattenCmd.Flags().IntVar(&flattenLimits.MaxEntries, "max-entries", flattenLimits.MaxEntries, "--max-entries caps the number of entries in an archive, 0 disables")
+	flattenCmd.Flags().Float64Var(&flattenLimits.MaxRatio, "max-ratio", flattenLimits.MaxRatio, "--max-ratio caps the compression ratio of any entry, 0 disables")
+	flattenCmd.Flags().StringVar(&flattenCharset, "charset", "cp437", "--charset decodes archive entry names that aren't UTF-8: "+strings.Join(archive.CharsetNames(), ", "))
+	addCollisionFlag(flattenCmd)
 	RootCmd.AddCommand(flattenCmd)
 }
 
@@ -45,9 +59,35 @@ var flattenCmd = &cobra.Command{
 			logrus.Fatal("flatten requires a [source folder] and [dest folder]")
 		}
 
-		op.FlattenFolderByExtension(args[0], args[1],
-			mapset.NewThreadUnsafeSetFromSlice([]interface{}{
-				".psd", ".pdf", ".png", ".gif", ".jpg", ".jpeg", ".tiff", ".nef", ".raw"}))
+		extensions := mapset.NewThreadUnsafeSet()
+		for _, name := range flattenCategories {
+			set, ok := op.CategoryExtensions(name)
+			if !ok {
+				logrus.Fatalf("Unknown category: %s", name)
+			}
+			extensions = extensions.Union(set)
+		}
 
+		charset, err := archive.LookupCharset(flattenCharset)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		reporter, stop := startProgress()
+		result, err := op.FlattenFolderByExtension(rootCtx, args[0], args[1], op.FlattenOptions{
+			Extensions: extensions,
+			Archives:   flattenArchives,
+			Limits:     flattenLimits,
+			Charset:    charset,
+			Progress:   reporter,
+			Collision:  collisionPolicy(),
+		})
+		stop()
+		emitFiles(result)
+		finishRun(opSummary("flatten", result.Stats()))
+		checkInterrupted()
+		if err != nil {
+			logrus.Fatal(err)
+		}
 	},
 }
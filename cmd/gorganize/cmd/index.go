@@ -0,0 +1,139 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"github.com/deckarep/gorganize/file_management/catalog"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	catalogPath string
+	indexForce  bool
+)
+
+func init() {
+	for _, c := range []*cobra.Command{indexCmd, findCmd} {
+		c.Flags().StringVar(&catalogPath, "catalog", catalog.DefaultPath(), "--catalog is the catalog file to use")
+	}
+	indexCmd.Flags().BoolVar(&indexForce, "force", false, "--force indexes roots that look like the mountpoint of an unplugged drive, dropping their missing files")
+	RootCmd.AddCommand(indexCmd)
+}
+
+func openCatalog() *catalog.Catalog {
+	c, err := catalog.Open(vfs.OS, catalogPath)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return c
+}
+
+var indexCmd = &cobra.Command{
+	Use:   "index [root(s) ...]",
+	Short: "index records the files below one or more folders in the catalog",
+	Long: `index [root(s) ...] records the path, size, modification time, md5, type,
+capture date, camera and tags of every file below the roots in --catalog, for
+find to search while the drives are offline.
+
+Re-indexing only hashes files whose size or modification time changed and drops
+files that are gone. Without roots every indexed root that can be reached is
+brought up to date, the entries of roots that can't be reached are kept. So are
+the entries of a root that is now on another device or came up empty, as the
+mountpoint of an unplugged drive does, unless --force is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := openCatalog()
+		roots := args
+		if len(roots) == 0 {
+			for _, r := range c.Roots {
+				roots = append(roots, r.Path)
+			}
+			if len(roots) == 0 {
+				logrus.Fatal("index requires at least one [root], the catalog has none yet")
+			}
+		}
+
+		reporter, stop := startProgress()
+		total := &catalog.IndexResult{}
+		failed := false
+		for _, root := range roots {
+			result, err := c.Index(rootCtx, root, catalog.IndexOptions{Progress: reporter, Force: indexForce})
+			for _, e := range result.Added {
+				emit(indexRecord{Type: "index", Path: e.Path, Change: "added", MD5: e.MD5}, "")
+			}
+			for _, e := range result.Updated {
+				emit(indexRecord{Type: "index", Path: e.Path, Change: "updated", MD5: e.MD5}, "")
+			}
+			for _, path := range result.Removed {
+				emit(indexRecord{Type: "index", Path: path, Change: "removed"}, "")
+			}
+			total.Unchanged += result.Unchanged
+			total.Failed += result.Failed
+			total.Bytes += result.Bytes
+			total.Elapsed += result.Elapsed
+			total.Added = append(total.Added, result.Added...)
+			total.Updated = append(total.Updated, result.Updated...)
+			total.Removed = append(total.Removed, result.Removed...)
+
+			if rootCtx.Err() != nil {
+				break
+			}
+			if err != nil {
+				logrus.Error(err)
+				failed = true
+			} else {
+				logrus.Infof("Indexed %s", root)
+			}
+		}
+		stop()
+
+		// What was indexed before an interruption is kept.
+		if err := c.Save(vfs.OS, catalogPath); err != nil {
+			logrus.Fatal(err)
+		}
+		finishRun(indexSummary(total))
+		checkInterrupted()
+		if failed {
+			logrus.Fatal("Some roots couldn't be indexed")
+		}
+	},
+}
+
+// indexRecord is a file that index added, updated or removed.
+type indexRecord struct {
+	Type   string `json:"type"`
+	Path   string `json:"path"`
+	Change string `json:"change"`
+	MD5    string `json:"md5,omitempty"`
+}
+
+func indexSummary(result *catalog.IndexResult) *summary {
+	s := &summary{command: "index", elapsed: result.Elapsed}
+	s.add("added", len(result.Added))
+	s.add("updated", len(result.Updated))
+	s.add("unchanged", result.Unchanged)
+	s.add("removed", len(result.Removed))
+	s.add("failed", result.Failed)
+	s.addBytes("bytes", result.Bytes)
+	return s
+}
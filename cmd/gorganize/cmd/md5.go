@@ -22,7 +22,11 @@ SOFTWARE.
 package cmd
 
 import (
+	"os"
+
 	md5 "github.com/deckarep/gorganize/file_management/md5"
+	"github.com/deckarep/gorganize/file_management/progress"
+	"github.com/deckarep/gorganize/file_management/vfs"
 	"github.com/sirupsen/logrus"
 
 	"github.com/spf13/cobra"
@@ -37,7 +41,19 @@ var md5Cmd = &cobra.Command{
 	Short: "calculates hashes against one or more files",
 	Long:  "md5 [file(s) ...] will calculate md5 operations against one or more files.",
 	Run: func(cmd *cobra.Command, args []string) {
-		producerChan, receiverChan := md5.PSum(0)
+		reporter, stop := startProgress()
+		defer stop()
+		tracker := progress.NewTracker("md5", reporter)
+		defer tracker.Done()
+		for _, file := range args {
+			if info, err := os.Stat(file); err == nil {
+				tracker.Discovered(1, info.Size())
+			} else {
+				tracker.Discovered(1, 0)
+			}
+		}
+
+		producerChan, receiverChan := md5.PSum(rootCtx, vfs.OS, 0, tracker)
 
 		go func() {
 			for _, file := range args {
@@ -47,7 +63,13 @@ var md5Cmd = &cobra.Command{
 		}()
 
 		for result := range receiverChan {
-			logrus.Infof("%s %s", result.Hash, result.Name)
+			if result.Err != nil {
+				logrus.Error("Error calculating md5 sum: ", result.Err.Error())
+				emit(hashRecord{Type: "hash", Path: result.Name, Error: result.Err.Error()}, "")
+				continue
+			}
+			emit(hashRecord{Type: "hash", Path: result.Name, MD5: result.Hash}, result.Hash+"  "+result.Name)
 		}
+		checkInterrupted()
 	},
 }
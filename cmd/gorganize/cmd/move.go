@@ -0,0 +1,93 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	movePruneEmpty bool
+)
+
+func init() {
+	moveCmd.Flags().BoolVarP(&movePruneEmpty, "prune-empty", "p", false, "--prune-empty removes source folders left empty by the move")
+	addCollisionFlag(moveCmd)
+	RootCmd.AddCommand(moveCmd)
+}
+
+var moveCmd = &cobra.Command{
+	Use:   "move [file(s)|directories(s) ...] [dest folder]",
+	Short: "moves one or more files into a folder",
+	Long: `move [file(s)|directories(s) ...] [dest folder] moves files or directories recursively into dest folder.
+
+Files are renamed when source and destination share a filesystem, otherwise they
+are copied, verified by hash and then removed. Collisions are handled like copy.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			logrus.Fatal("move requires at least one source and a [dest folder]")
+		}
+
+		destFolder := args[len(args)-1]
+		if err := os.MkdirAll(destFolder, 0777); err != nil {
+			logrus.Fatalf("Couldn't create destination dir:%s with err: %s", destFolder, err)
+		}
+
+		start := time.Now()
+		var stats op.Stats
+		for _, source := range args[:len(args)-1] {
+			info, err := os.Stat(source)
+			if err != nil {
+				logrus.Error("Couldn't stat source: ", err)
+				continue
+			}
+
+			dest := filepath.Join(destFolder, filepath.Base(filepath.Clean(source)))
+			if info.IsDir() {
+				var result *op.Result
+				result, err = op.MoveFolder(rootCtx, source, dest, op.MoveOptions{PruneEmpty: movePruneEmpty, Collision: collisionPolicy()})
+				emitFiles(result)
+				stats = stats.Add(result.Stats())
+			} else {
+				var fr op.FileResult
+				fr, err = op.MoveFile(rootCtx, source, dest, op.Options{Collision: collisionPolicy()})
+				emitFile(fr)
+				stats = stats.Add((&op.Result{Files: []op.FileResult{fr}}).Stats())
+			}
+			if rootCtx.Err() != nil {
+				break
+			}
+			if err != nil {
+				logrus.Errorf("Failed to move: %s with err: %s", source, err)
+			}
+		}
+		stats.Elapsed = time.Since(start)
+		finishRun(opSummary("move", stats))
+		checkInterrupted()
+	},
+}
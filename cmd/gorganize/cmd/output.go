@@ -0,0 +1,197 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/deckarep/gorganize/file_management/unzip"
+	"github.com/sirupsen/logrus"
+)
+
+// The values of --output.
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+// records holds what a command printed so far in json mode, which writes
+// them as one array once the command is done.
+var records struct {
+	sync.Mutex
+	list []interface{}
+}
+
+func checkOutputFormat() {
+	switch outputFlag {
+	case outputText, outputJSON, outputNDJSON:
+	default:
+		logrus.Fatalf("Unknown --output: %s, expected text, json or ndjson", outputFlag)
+	}
+}
+
+// emit prints a record of what a command did to stdout and keeps it for
+// --report. In text mode text is printed instead, an empty text leaves the log
+// lines on stderr to tell the story.
+func emit(record interface{}, text string) {
+	recordAction(record)
+	write(record, text)
+}
+
+// write prints record, or text in text mode, without keeping it for the report.
+func write(record interface{}, text string) {
+	switch outputFlag {
+	case outputNDJSON:
+		records.Lock()
+		defer records.Unlock()
+		if err := json.NewEncoder(os.Stdout).Encode(record); err != nil {
+			logrus.Fatal(err)
+		}
+	case outputJSON:
+		records.Lock()
+		records.list = append(records.list, record)
+		records.Unlock()
+	default:
+		if text != "" {
+			fmt.Println(text)
+		}
+	}
+}
+
+var finishOnce sync.Once
+
+// finishOutput writes what was held back until the command is done. It runs
+// after the command and from the exit handler of fatal errors, so what was
+// done before them is still reported.
+func finishOutput() {
+	finishOnce.Do(func() {
+		flushOutput()
+		writeReport()
+	})
+}
+
+// flushOutput writes the records collected in json mode, commands that
+// emitted nothing print an empty array.
+func flushOutput() {
+	if outputFlag != outputJSON {
+		return
+	}
+	records.Lock()
+	list := records.list
+	records.list = nil
+	records.Unlock()
+
+	if list == nil {
+		list = []interface{}{}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(list); err != nil {
+		// Not Fatal, this also runs from the exit handler.
+		logrus.Error(err)
+	}
+}
+
+// hashRecord is the outcome of hashing a file.
+type hashRecord struct {
+	Type  string `json:"type"`
+	Path  string `json:"path"`
+	MD5   string `json:"md5,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// fileRecord is the outcome of copying or moving a file.
+type fileRecord struct {
+	Type   string `json:"type"`
+	Src    string `json:"src"`
+	Dst    string `json:"dst,omitempty"`
+	Action string `json:"action"`
+	Bytes  int64  `json:"bytes"`
+	Error  string `json:"error,omitempty"`
+}
+
+// extractRecord is an archive or one of its entries handled by extract.
+type extractRecord struct {
+	Type    string `json:"type"`
+	Archive string `json:"archive"`
+	Entry   string `json:"entry,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func emitFile(fr op.FileResult) {
+	emit(fileRecord{
+		Type:   "file",
+		Src:    fr.Src,
+		Dst:    fr.Dst,
+		Action: string(fr.Action),
+		Bytes:  fr.Bytes,
+		Error:  errorString(fr.Err),
+	}, "")
+}
+
+func emitFiles(result *op.Result) {
+	if result == nil {
+		return
+	}
+	for _, fr := range result.Files {
+		emitFile(fr)
+	}
+}
+
+// emitArchives emits a record per archive followed by its written and failed
+// entries.
+func emitArchives(result *unzip.Result) {
+	if result == nil {
+		return
+	}
+	for _, ar := range result.Archives {
+		status := "extracted"
+		switch {
+		case ar.Err != nil:
+			status = "failed"
+		case ar.Duplicate:
+			status = "skipped-identical"
+		}
+		emit(extractRecord{Type: "archive", Archive: ar.Path, Path: ar.Dest, Status: status, Error: errorString(ar.Err)}, "")
+
+		for _, path := range ar.Written {
+			emit(extractRecord{Type: "entry", Archive: ar.Path, Path: path, Status: "extracted"}, "")
+		}
+		for _, e := range ar.Failed {
+			emit(extractRecord{Type: "entry", Archive: ar.Path, Entry: e.Entry, Status: "failed", Error: errorString(e.Err)}, "")
+		}
+	}
+}
@@ -0,0 +1,226 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/progress"
+	"github.com/sirupsen/logrus"
+)
+
+// progressLogInterval is how often progress is logged when there is no
+// terminal to draw a bar on.
+const progressLogInterval = 5 * time.Second
+
+// progressBarWidth is the width of the bar itself, not the whole line.
+const progressBarWidth = 30
+
+// startProgress returns the reporter commands hand to long operations and a
+// func to call once they are done. On a terminal a live bar is drawn below the
+// log lines, otherwise progress is logged every few seconds. The reporter is
+// nil when --no-progress is set.
+func startProgress() (progress.Reporter, func()) {
+	if noProgressFlag {
+		return nil, func() {}
+	}
+
+	out := logrus.StandardLogger().Out
+	if f, ok := out.(*os.File); ok && isTerminal(f) {
+		bar := &progressBar{out: f}
+		logrus.SetOutput(bar)
+		return bar, func() {
+			bar.stop()
+			logrus.SetOutput(out)
+		}
+	}
+	return &progressLog{}, func() {}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar draws the latest event on the last line of the terminal. Log
+// lines are written through it so they scroll above the bar.
+type progressBar struct {
+	mu    sync.Mutex
+	out   io.Writer
+	event progress.Event
+	drawn bool
+}
+
+func (b *progressBar) Progress(e progress.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.event = e
+	b.draw()
+	if e.Done {
+		fmt.Fprintln(b.out)
+		b.drawn = false
+	}
+}
+
+func (b *progressBar) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.clear()
+	n, err := b.out.Write(p)
+	if b.event.Op != "" && !b.event.Done {
+		b.draw()
+	}
+	return n, err
+}
+
+func (b *progressBar) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.drawn {
+		fmt.Fprintln(b.out)
+		b.drawn = false
+	}
+}
+
+func (b *progressBar) clear() {
+	if b.drawn {
+		fmt.Fprint(b.out, "\r\033[K")
+		b.drawn = false
+	}
+}
+
+func (b *progressBar) draw() {
+	e := b.event
+	line := fmt.Sprintf("%s [%s] %s", e.Op, bar(e), progressSummary(e))
+	if e.Current != "" {
+		line += "  " + filepath.Base(e.Current)
+	}
+	fmt.Fprint(b.out, "\r\033[K"+truncate(line, terminalWidth()-1))
+	b.drawn = true
+}
+
+// bar renders the filled part of the bar, a spinner like bounce when the total
+// isn't known yet.
+func bar(e progress.Event) string {
+	var done float64
+	switch {
+	case e.Done:
+		done = 1
+	case e.BytesDiscovered > 0:
+		done = float64(e.BytesProcessed) / float64(e.BytesDiscovered)
+	case e.FilesDiscovered > 0:
+		done = float64(e.Files()) / float64(e.FilesDiscovered)
+	}
+	if done > 1 {
+		done = 1
+	}
+	filled := int(done * progressBarWidth)
+	s := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		s += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	return s
+}
+
+// progressLog logs the latest event every progressLogInterval, for output
+// that isn't a terminal.
+type progressLog struct {
+	last time.Time
+}
+
+func (l *progressLog) Progress(e progress.Event) {
+	if !e.Done && time.Since(l.last) < progressLogInterval {
+		return
+	}
+	l.last = time.Now()
+	logrus.Infof("%s: %s", e.Op, progressSummary(e))
+}
+
+// progressSummary is the counts, rate and ETA of e on one line.
+func progressSummary(e progress.Event) string {
+	parts := []string{fmt.Sprintf("%d/%d files", e.Files(), e.FilesDiscovered)}
+	if e.BytesDiscovered > 0 {
+		parts = append(parts, fmt.Sprintf("%s/%s", formatBytes(e.BytesProcessed), formatBytes(e.BytesDiscovered)))
+	}
+	if e.FilesSkipped > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped", e.FilesSkipped))
+	}
+	if e.FilesFailed > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", e.FilesFailed))
+	}
+	parts = append(parts, formatBytes(int64(e.Throughput))+"/s")
+	switch {
+	case e.Done:
+		parts = append(parts, "in "+formatDuration(e.Elapsed))
+	case e.ETA >= 0:
+		parts = append(parts, "ETA "+formatDuration(e.ETA))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatBytes renders n with a binary unit, as in 1.2 GiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatDuration renders d as h:mm:ss or m:ss.
+func formatDuration(d time.Duration) string {
+	s := int(d.Round(time.Second) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// terminalWidth is taken from $COLUMNS, falling back to 80.
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+func truncate(s string, width int) string {
+	if r := []rune(s); len(r) > width {
+		return string(r[:width])
+	}
+	return s
+}
@@ -0,0 +1,145 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	renameMatch   string
+	renameDryRun  bool
+	renameJournal string
+	renameUndo    bool
+)
+
+func init() {
+	renameCmd.Flags().StringVarP(&renameMatch, "match", "m", "", "--match only renames files whose name matches the glob")
+	renameCmd.Flags().BoolVarP(&renameDryRun, "dry-run", "n", false, "--dry-run prints the preview table without renaming")
+	renameCmd.Flags().StringVarP(&renameJournal, "journal", "j", "gorganize-rename.journal", "--journal is the undo journal to record renames in")
+	renameCmd.Flags().BoolVar(&renameUndo, "undo", false, "--undo reverts the renames recorded in --journal")
+	RootCmd.AddCommand(renameCmd)
+}
+
+var renameCmd = &cobra.Command{
+	Use:   "rename [template] [file(s)|directories(s) ...]",
+	Short: "renames files in batch using a template",
+	Long: `rename [template] [file(s)|directories(s) ...] renames every matched file using a template.
+
+Templates may contain the tokens {name}, {ext}, {parent}, {camera},
+{date:2006-01-02}, {seq:04} and {hash:8}. A preview is always printed and the
+batch is refused if any two files would collide or a target already exists.
+[template] may also name a template from the [templates] table of the config.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if renameUndo {
+			if err := op.UndoRename(renameJournal, op.Options{}); err != nil {
+				logrus.Fatal("Couldn't undo renames: ", err)
+			}
+			return
+		}
+
+		if len(args) < 2 {
+			logrus.Fatal("rename requires a [template] and at least one file or directory")
+		}
+
+		text := args[0]
+		if named, ok := appConfig.Templates[text]; ok {
+			text = named
+		}
+		tmpl, err := op.ParseTemplate(text)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		var filter op.Filter
+		if renameMatch != "" {
+			filter.Include = []string{renameMatch}
+		}
+		files, err := op.CollectFiles(vfs.OS, args[1:], filter)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		plans, err := op.PlanRename(rootCtx, vfs.OS, files, tmpl)
+		if err != nil {
+			checkInterrupted()
+			logrus.Fatal(err)
+		}
+
+		conflicts := printRenamePreview(plans)
+		if conflicts > 0 {
+			logrus.Fatalf("Found %d conflict(s), nothing was renamed", conflicts)
+		}
+		if renameDryRun {
+			return
+		}
+
+		if err := op.ApplyRename(rootCtx, plans, renameJournal, op.Options{}); err != nil {
+			checkInterrupted()
+			logrus.Fatal(err)
+		}
+	},
+}
+
+// renameRecord is a planned rename.
+type renameRecord struct {
+	Type     string `json:"type"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Status   string `json:"status"`
+	Conflict string `json:"conflict,omitempty"`
+}
+
+func printRenamePreview(plans []op.RenamePlan) int {
+	conflicts := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if outputFlag == outputText {
+		fmt.Fprintln(w, "FROM\tTO\tSTATUS")
+	}
+	for _, p := range plans {
+		status := "ok"
+		switch {
+		case p.Conflict != "":
+			status = "conflict"
+			conflicts++
+		case p.From == p.To:
+			status = "unchanged"
+		}
+		if outputFlag != outputText {
+			emit(renameRecord{Type: "rename", From: p.From, To: p.To, Status: status, Conflict: p.Conflict}, "")
+			continue
+		}
+		if p.Conflict != "" {
+			status += ": " + p.Conflict
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", p.From, p.To, status)
+	}
+	w.Flush()
+	return conflicts
+}
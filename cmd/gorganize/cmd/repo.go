@@ -0,0 +1,88 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	repoCmd.PersistentFlags().StringVarP(&snapshotRepo, "repo", "r", "", "--repo is the path of the snapshot repository")
+
+	repoCmd.AddCommand(repoStatsCmd)
+	RootCmd.AddCommand(repoCmd)
+}
+
+var repoCmd = &cobra.Command{
+	Use:   "repo",
+	Short: "repo inspects a snapshot repository",
+}
+
+var repoStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "shows how much space a snapshot repository saves through dedupe",
+	Run: func(cmd *cobra.Command, args []string) {
+		stats, err := openSnapshotRepo().Stats(rootCtx)
+		if err != nil {
+			checkInterrupted()
+			logrus.Fatal(err)
+		}
+
+		if outputFlag != outputText {
+			emit(statsRecord{
+				Type:         "stats",
+				Snapshots:    stats.Snapshots,
+				Files:        stats.Files,
+				LogicalBytes: stats.LogicalBytes,
+				Chunks:       stats.Chunks,
+				StoredBytes:  stats.StoredBytes,
+				Ratio:        stats.Ratio(),
+			}, "")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "snapshots\t%d\n", stats.Snapshots)
+		fmt.Fprintf(w, "files\t%d\n", stats.Files)
+		fmt.Fprintf(w, "logical bytes\t%d\n", stats.LogicalBytes)
+		fmt.Fprintf(w, "chunks\t%d\n", stats.Chunks)
+		fmt.Fprintf(w, "stored bytes\t%d\n", stats.StoredBytes)
+		fmt.Fprintf(w, "dedupe ratio\t%.2fx\n", stats.Ratio())
+		w.Flush()
+	},
+}
+
+// statsRecord is the JSON shape of repo stats.
+type statsRecord struct {
+	Type         string  `json:"type"`
+	Snapshots    int     `json:"snapshots"`
+	Files        int     `json:"files"`
+	LogicalBytes int64   `json:"logical_bytes"`
+	Chunks       int     `json:"chunks"`
+	StoredBytes  int64   `json:"stored_bytes"`
+	Ratio        float64 `json:"ratio"`
+}
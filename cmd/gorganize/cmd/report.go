@@ -0,0 +1,348 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/deckarep/gorganize/file_management/rules"
+	"github.com/deckarep/gorganize/file_management/unzip"
+	"github.com/sirupsen/logrus"
+)
+
+// run is what the current command did, kept for --report.
+var run struct {
+	sync.Mutex
+	command string
+	started time.Time
+	summary *summary
+	actions []interface{}
+}
+
+func checkReportFormat() {
+	if reportFlag == "" {
+		return
+	}
+	switch strings.ToLower(filepath.Ext(reportFlag)) {
+	case ".json", ".html", ".htm":
+	default:
+		logrus.Fatalf("Unknown --report: %s, expected a .json or .html file", reportFlag)
+	}
+}
+
+func startRun(command string) {
+	run.Lock()
+	run.command, run.started = command, time.Now()
+	run.Unlock()
+}
+
+// recordAction keeps a record emitted by the command for the report.
+func recordAction(record interface{}) {
+	if reportFlag == "" {
+		return
+	}
+	run.Lock()
+	run.actions = append(run.actions, record)
+	run.Unlock()
+}
+
+// summaryRow is a single statistic of the end-of-run summary.
+type summaryRow struct {
+	name  string
+	value int64
+	bytes bool
+}
+
+// summary is the end-of-run statistics of a command, rows in display order.
+type summary struct {
+	command string
+	rows    []summaryRow
+	elapsed time.Duration
+}
+
+func (s *summary) add(name string, value int) {
+	s.rows = append(s.rows, summaryRow{name: name, value: int64(value)})
+}
+
+func (s *summary) addBytes(name string, value int64) {
+	s.rows = append(s.rows, summaryRow{name: name, value: value, bytes: true})
+}
+
+// MarshalJSON keeps the rows in display order.
+func (s *summary) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"type":"summary","command":%q`, s.command)
+	for _, row := range s.rows {
+		fmt.Fprintf(&buf, `,%q:%d`, strings.Replace(row.name, "-", "_", -1), row.value)
+	}
+	fmt.Fprintf(&buf, `,"elapsed_seconds":%.3f}`, s.elapsed.Seconds())
+	return buf.Bytes(), nil
+}
+
+// table renders s aligned for the terminal.
+func (s *summary) table() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	for _, row := range s.rows {
+		value := fmt.Sprint(row.value)
+		if row.bytes {
+			value = formatBytes(row.value)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", row.name, value)
+	}
+	fmt.Fprintf(w, "elapsed\t%s\n", formatDuration(s.elapsed))
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func opSummary(command string, stats op.Stats) *summary {
+	s := &summary{command: command, elapsed: stats.Elapsed}
+	if stats.Moved > 0 {
+		s.add("moved", stats.Moved)
+	} else {
+		s.add("copied", stats.Copied)
+	}
+	s.add("skipped", stats.Skipped)
+	s.add("renamed", stats.Renamed)
+	if stats.Overwritten > 0 {
+		s.add("overwritten", stats.Overwritten)
+	}
+	s.add("failed", stats.Failed)
+	s.addBytes("bytes", stats.Bytes)
+	return s
+}
+
+func unzipSummary(stats unzip.Stats) *summary {
+	s := &summary{command: "extract", elapsed: stats.Elapsed}
+	s.add("archives", stats.Extracted)
+	s.add("skipped-identical", stats.Duplicates)
+	s.add("failed", stats.Failed)
+	s.add("entries", stats.Entries)
+	s.add("failed-entries", stats.FailedEntries)
+	s.addBytes("bytes", stats.Bytes)
+	return s
+}
+
+func applySummary(command string, stats rules.Stats) *summary {
+	s := &summary{command: command, elapsed: stats.Elapsed}
+	s.add("files", stats.Files)
+	s.add("unmatched", stats.Unmatched)
+	if stats.Planned > 0 {
+		s.add("planned", stats.Planned)
+	}
+	// Actions no rule carried out are left out.
+	for _, row := range []summaryRow{
+		{"copied", int64(stats.Copied), false},
+		{"moved", int64(stats.Moved), false},
+		{"renamed", int64(stats.Renamed), false},
+		{"extracted", int64(stats.Extracted), false},
+		{"deleted", int64(stats.Deleted), false},
+		{"tagged", int64(stats.Tagged), false},
+	} {
+		if row.value > 0 {
+			s.rows = append(s.rows, row)
+		}
+	}
+	s.add("skipped", stats.Skipped)
+	s.add("failed", stats.Failed)
+	s.addBytes("bytes", stats.Bytes)
+	return s
+}
+
+// finishRun prints the summary of the command, as a table in text mode and a
+// record otherwise.
+func finishRun(s *summary) {
+	run.Lock()
+	run.summary = s
+	run.Unlock()
+
+	write(s, s.table())
+}
+
+// report is the JSON shape of --report.
+type report struct {
+	Command  string        `json:"command"`
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	Summary  *summary      `json:"summary,omitempty"`
+	Actions  []interface{} `json:"actions"`
+}
+
+// writeReport writes --report, if asked for, with everything the command did.
+func writeReport() {
+	if reportFlag == "" {
+		return
+	}
+	run.Lock()
+	r := report{
+		Command:  run.command,
+		Started:  run.started,
+		Finished: time.Now(),
+		Summary:  run.summary,
+		Actions:  run.actions,
+	}
+	run.Unlock()
+	if r.Actions == nil {
+		r.Actions = []interface{}{}
+	}
+
+	f, err := os.Create(reportFlag)
+	if err != nil {
+		// Not Fatal, this also runs from the exit handler.
+		logrus.Error("Couldn't create report: ", err)
+		return
+	}
+	defer f.Close()
+
+	if ext := strings.ToLower(filepath.Ext(reportFlag)); ext == ".html" || ext == ".htm" {
+		err = reportTemplate.Execute(f, newHTMLReport(r))
+	} else {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	}
+	if err != nil {
+		logrus.Error("Couldn't write report: ", err)
+	}
+}
+
+// htmlReport is report laid out as tables.
+type htmlReport struct {
+	report
+	Summary [][2]string
+	Columns []string
+	Rows    [][]string
+}
+
+// newHTMLReport flattens the actions into rows, the columns are the union of
+// their JSON fields in the order first seen.
+func newHTMLReport(r report) htmlReport {
+	h := htmlReport{report: r}
+	if r.Summary != nil {
+		for _, row := range r.Summary.rows {
+			value := fmt.Sprint(row.value)
+			if row.bytes {
+				value = fmt.Sprintf("%s (%d)", formatBytes(row.value), row.value)
+			}
+			h.Summary = append(h.Summary, [2]string{row.name, value})
+		}
+		h.Summary = append(h.Summary, [2]string{"elapsed", formatDuration(r.Summary.elapsed)})
+	}
+
+	index := make(map[string]int)
+	var fields []map[string]string
+	for _, action := range r.Actions {
+		names, values := recordFields(action)
+		row := make(map[string]string)
+		for i, name := range names {
+			if _, ok := index[name]; !ok {
+				index[name] = len(h.Columns)
+				h.Columns = append(h.Columns, name)
+			}
+			row[name] = values[i]
+		}
+		fields = append(fields, row)
+	}
+	for _, row := range fields {
+		cells := make([]string, len(h.Columns))
+		for name, value := range row {
+			cells[index[name]] = value
+		}
+		h.Rows = append(h.Rows, cells)
+	}
+	return h
+}
+
+// recordFields lists the JSON names and values of the fields of a record
+// struct, leaving out empty ones.
+func recordFields(record interface{}) ([]string, []string) {
+	v := reflect.Indirect(reflect.ValueOf(record))
+	if v.Kind() != reflect.Struct {
+		return []string{"value"}, []string{fmt.Sprint(record)}
+	}
+
+	var names, values []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || field.PkgPath != "" {
+			continue
+		}
+		value := v.Field(i)
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		text := fmt.Sprint(value.Interface())
+		if t, ok := value.Interface().(time.Time); ok {
+			text = t.Format("2006-01-02 15:04:05")
+		}
+		if reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface()) {
+			text = ""
+		}
+		names = append(names, name)
+		values = append(values, text)
+	}
+	return names, values
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gorganize {{.Command}} report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; font-size: 0.9em; }
+th { background: #f0f0f0; }
+tr.failed td { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>gorganize {{.Command}}</h1>
+<p>Started {{.Started.Format "2006-01-02 15:04:05"}}, finished {{.Finished.Format "2006-01-02 15:04:05"}}.</p>
+{{if .Summary}}<h2>Summary</h2>
+<table>
+{{range .Summary}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+{{end}}<h2>Actions ({{len .Rows}})</h2>
+<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr{{range .}}{{if eq . "failed"}} class="failed"{{end}}{{end}}>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
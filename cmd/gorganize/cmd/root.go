@@ -24,32 +24,57 @@ package cmd
 import (
 	"os"
 
+	"github.com/deckarep/gorganize/file_management/logging"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 func init() {
-	cobra.OnInitialize(initLogger)
 	RootCmd.PersistentFlags().BoolVarP(&debugFlag, "debug", "d", false, "--debug turns on debug logs")
+	RootCmd.PersistentFlags().BoolVar(&noProgressFlag, "no-progress", false, "--no-progress turns off progress bars and periodic progress logs")
+	RootCmd.PersistentFlags().StringVar(&outputFlag, "output", outputText, "--output is text, json or ndjson, records of what was done are written to stdout and logs to stderr")
+	RootCmd.PersistentFlags().StringVar(&reportFlag, "report", "", "--report writes every action and the summary to a .json or .html file")
+	RootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "--profile applies a named profile from the config files")
 }
 
+// initLogger sends logs to stderr, keeping stdout for the records of --output.
 func initLogger() {
 	logrus.SetFormatter(&logrus.TextFormatter{
-		ForceColors: true,
+		ForceColors: isTerminal(os.Stderr),
 	})
 
 	logrus.SetLevel(logrus.InfoLevel)
 	if debugFlag {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
-	logrus.SetOutput(os.Stdout)
+	logrus.SetOutput(os.Stderr)
+	logging.Default = logrus.StandardLogger()
+
+	// Fatal errors still print what was done before them.
+	logrus.RegisterExitHandler(finishOutput)
 }
 
 var (
-	debugFlag bool
+	debugFlag      bool
+	noProgressFlag bool
+	outputFlag     string
+	reportFlag     string
+	profileFlag    string
 	// RootCmd is the root command into gorganize.
 	RootCmd = &cobra.Command{
 		Use:   "gorganize",
 		Short: "gorganize helps you organize your user documents, settings and media.",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// Config first, it may set any of the flags below.
+			loadConfig(cmd)
+			initLogger()
+			handleSignals()
+			checkOutputFormat()
+			checkReportFormat()
+			startRun(commandName(cmd))
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			finishOutput()
+		},
 	}
 )
@@ -0,0 +1,78 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rootCtx is handed to every operation, the first SIGINT or SIGTERM cancels
+// it so operations stop at the next point where nothing is left half written.
+var rootCtx = context.Background()
+
+// caught is the signal that cancelled rootCtx.
+var caught = make(chan os.Signal, 1)
+
+// handleSignals cancels rootCtx on the first SIGINT or SIGTERM, the second
+// one exits right away.
+func handleSignals() {
+	ctx, cancel := context.WithCancel(context.Background())
+	rootCtx = ctx
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		caught <- sig
+		logrus.Warnf("Received %s, stopping, press ctrl-C again to quit right away", sig)
+		cancel()
+
+		sig = <-signals
+		logrus.Errorf("Received %s again, quitting", sig)
+		os.Exit(exitStatus(sig))
+	}()
+}
+
+// exitStatus is what shells report for a process killed by sig.
+func exitStatus(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// checkInterrupted exits once an interrupted command has returned from its
+// operation, after writing the output and partial summary it has so far.
+func checkInterrupted() {
+	if rootCtx.Err() == nil {
+		return
+	}
+	sig := <-caught
+	logrus.Warn("Interrupted, stopped early")
+	finishOutput()
+	os.Exit(exitStatus(sig))
+}
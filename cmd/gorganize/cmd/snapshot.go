@@ -0,0 +1,176 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/snapshot"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotRepo      string
+	snapshotOverwrite bool
+)
+
+func init() {
+	snapshotCmd.PersistentFlags().StringVarP(&snapshotRepo, "repo", "r", "", "--repo is the path of the snapshot repository")
+	snapshotRestoreCmd.Flags().BoolVar(&snapshotOverwrite, "overwrite", false, "--overwrite replaces files that already exist in the target")
+
+	snapshotCmd.AddCommand(snapshotCreateCmd, snapshotListCmd, snapshotDiffCmd, snapshotRestoreCmd)
+	RootCmd.AddCommand(snapshotCmd)
+}
+
+func openSnapshotRepo() *snapshot.Repo {
+	if snapshotRepo == "" {
+		logrus.Fatal("snapshot requires a --repo path")
+	}
+	repo, err := snapshot.Open(nil, snapshotRepo)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return repo
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "snapshot backs up folders into a deduplicated local repository",
+	Long:  "snapshot stores file contents by hash in a repository so unchanged files are only kept once across snapshots.",
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create [directories(s) ...]",
+	Short: "records a new snapshot of one or more folders",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			logrus.Fatal("snapshot create requires at least one directory")
+		}
+
+		s, err := openSnapshotRepo().Create(rootCtx, args, snapshot.CreateOptions{})
+		if err != nil {
+			checkInterrupted()
+			logrus.Fatal(err)
+		}
+		logrus.Infof("Created snapshot %s: %d files, %d bytes, %d new bytes stored",
+			s.ID, len(s.Files), s.Size(), s.Stored)
+		emit(newSnapshotRecord(s), "")
+	},
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists the snapshots in a repository",
+	Run: func(cmd *cobra.Command, args []string) {
+		snapshots, err := openSnapshotRepo().List(rootCtx)
+		if err != nil {
+			checkInterrupted()
+			logrus.Fatal(err)
+		}
+
+		if outputFlag != outputText {
+			for _, s := range snapshots {
+				emit(newSnapshotRecord(s), "")
+			}
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTIME\tFILES\tSIZE\tROOTS")
+		for _, s := range snapshots {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%v\n",
+				s.ID, s.Time.Format("2006-01-02 15:04:05"), len(s.Files), s.Size(), s.Roots)
+		}
+		w.Flush()
+	},
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:   "diff [snapshot id] [snapshot id]",
+	Short: "shows the files that changed between two snapshots",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			logrus.Fatal("snapshot diff requires two snapshot ids")
+		}
+
+		changes, err := openSnapshotRepo().Diff(rootCtx, args[0], args[1])
+		if err != nil {
+			checkInterrupted()
+			logrus.Fatal(err)
+		}
+		for _, c := range changes {
+			emit(changeRecord{Type: "change", Kind: c.Kind, Path: c.Path}, fmt.Sprintf("%-8s %s", c.Kind, c.Path))
+		}
+	},
+}
+
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore [snapshot id] [target folder]",
+	Short: "restores the files of a snapshot into a folder",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			logrus.Fatal("snapshot restore requires a [snapshot id] and [target folder]")
+		}
+
+		s, err := openSnapshotRepo().Restore(rootCtx, args[0], args[1], snapshot.RestoreOptions{Overwrite: snapshotOverwrite})
+		if err != nil {
+			checkInterrupted()
+			logrus.Fatal(err)
+		}
+		logrus.Infof("Restored snapshot %s into %s", s.ID, args[1])
+		emit(newSnapshotRecord(s), "")
+	},
+}
+
+// snapshotRecord describes a snapshot without its file list.
+type snapshotRecord struct {
+	Type   string    `json:"type"`
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Roots  []string  `json:"roots"`
+	Files  int       `json:"files"`
+	Bytes  int64     `json:"bytes"`
+	Stored int64     `json:"stored"`
+}
+
+func newSnapshotRecord(s *snapshot.Snapshot) snapshotRecord {
+	return snapshotRecord{
+		Type:   "snapshot",
+		ID:     s.ID,
+		Time:   s.Time,
+		Roots:  s.Roots,
+		Files:  len(s.Files),
+		Bytes:  s.Size(),
+		Stored: s.Stored,
+	}
+}
+
+// changeRecord is a file that differs between two snapshots.
+type changeRecord struct {
+	Type string `json:"type"`
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+}
@@ -0,0 +1,100 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncOptions op.SyncOptions
+)
+
+func init() {
+	syncCmd.Flags().BoolVarP(&syncOptions.Checksum, "checksum", "c", false, "--checksum also compares files by md5 when size and mtime match")
+	syncCmd.Flags().BoolVar(&syncOptions.Delete, "delete", false, "--delete removes files in dest that don't exist in source")
+	syncCmd.Flags().BoolVarP(&syncOptions.DryRun, "dry-run", "n", false, "--dry-run reports what would change without touching dest")
+	RootCmd.AddCommand(syncCmd)
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [source folder] [dest folder]",
+	Short: "sync makes a destination folder mirror a source folder.",
+	Long: `sync [source folder] [dest folder] copies new and changed files from source folder into dest folder.
+
+Files are compared by size and modification time, use --checksum to also compare
+content. With --delete files that no longer exist in source are removed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			logrus.Fatal("sync requires a [source folder] and [dest folder]")
+		}
+
+		report, err := op.SyncFolder(rootCtx, args[0], args[1], syncOptions)
+		if err != nil && rootCtx.Err() == nil {
+			logrus.Fatal(err)
+		}
+
+		emitSync("add", report.Added)
+		emitSync("update", report.Updated)
+		emitSync("delete", report.Deleted)
+		for _, err := range report.Errors {
+			emit(syncRecord{Type: "sync", Action: "failed", DryRun: syncOptions.DryRun, Error: err.Error()}, "")
+		}
+		if syncOptions.DryRun {
+			logrus.Info("Dry run, nothing in dest folder was changed")
+		}
+
+		s := &summary{command: "sync", elapsed: report.Elapsed}
+		s.add("added", len(report.Added))
+		s.add("updated", len(report.Updated))
+		s.add("deleted", len(report.Deleted))
+		s.add("unchanged", report.Unchanged)
+		s.add("failed", report.Failed)
+		s.addBytes("bytes", report.Bytes)
+		finishRun(s)
+		checkInterrupted()
+	},
+}
+
+// syncRecord is a file sync added, updated or deleted.
+type syncRecord struct {
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Path   string `json:"path,omitempty"`
+	DryRun bool   `json:"dry_run,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// emitSync emits a record per path, in text mode only a dry run lists them.
+func emitSync(action string, paths []string) {
+	for _, rel := range paths {
+		text := ""
+		if syncOptions.DryRun {
+			text = fmt.Sprintf("%-6s %s", action, rel)
+		}
+		emit(syncRecord{Type: "sync", Action: action, Path: rel, DryRun: syncOptions.DryRun}, text)
+	}
+}
@@ -1,49 +0,0 @@
-/*
-Open Source Initiative OSI - The MIT License (MIT):Licensing
-The MIT License (MIT)
-Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
-Permission is hereby granted, free of charge, to any person obtaining a copy of
-this software and associated documentation files (the "Software"), to deal in
-the Software without restriction, including without limitation the rights to
-use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
-of the Software, and to permit persons to whom the Software is furnished to do
-so, subject to the following conditions:
-The above copyright notice and this permission notice shall be included in all
-copies or substantial portions of the Software.
-THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
-IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
-FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
-AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
-LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
-OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
-SOFTWARE.
-*/
-
-package cmd
-
-import (
-	"github.com/deckarep/gorganize/file_management/unzip"
-	"github.com/spf13/cobra"
-)
-
-var (
-//flatten flag
-)
-
-func init() {
-	RootCmd.AddCommand(unzipCmd)
-}
-
-var unzipCmd = &cobra.Command{
-	Use:   "unzip [file(s)|directories(s) ...]",
-	Short: "uncompresses one or more files",
-	Long:  "unzip [file(s)|directories(s) ...] will unzip one or more files or directories recursively.",
-	Run: func(cmd *cobra.Command, args []string) {
-		for _, file := range args {
-			unzip.All(file)
-			// if err != nil {
-			// 	log.Fatal("Couldn't compute md5.Sum on file: ", file)
-			// }
-		}
-	},
-}
@@ -0,0 +1,109 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2017 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/rules"
+	"github.com/deckarep/gorganize/file_management/watch"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchOptions watch.Options
+	watchApply   rules.Options
+	watchRules   string
+)
+
+func init() {
+	watchCmd.Flags().StringVarP(&watchRules, "rules", "r", "", "--rules is the rules file new files are run through, see apply")
+	watchCmd.Flags().DurationVar(&watchOptions.Settle, "settle", watch.DefaultSettle, "--settle is how long a file must stay unchanged before it is handled")
+	watchCmd.Flags().StringVar(&watchOptions.State, "state", "", "--state remembers handled files between runs, defaults to "+watch.StateFile+" in the watched folder")
+	watchCmd.Flags().StringVarP(&watchApply.Dest, "dest", "o", "", "--dest is where relative rule destinations point, overriding the rules file")
+	watchCmd.Flags().StringVarP(&watchApply.Journal, "journal", "j", "gorganize-apply.journal", "--journal is the undo journal to record actions in, see apply --undo")
+	watchCmd.Flags().StringVar(&watchApply.Trash, "trash", "", "--trash is the folder deleted files are moved into, defaults to the journal's path with .trash appended")
+	addCollisionFlag(watchCmd)
+	RootCmd.AddCommand(watchCmd)
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [folder]",
+	Short: "watch organizes files as they arrive in a folder",
+	Long: `watch [folder] runs every file arriving in folder through the rules of --rules,
+once it has stopped changing for --settle.
+
+Files that arrived while watch wasn't running are caught up on at start. Handled
+files are remembered in --state so they aren't handled twice. Files below a rule
+destination, up to its first token, or below --journal and --trash are never
+handled, unless the watched folder itself is inside them. Stop with ctrl-C, the
+files being handled are finished first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			logrus.Fatal("watch requires a [folder]")
+		}
+		if watchRules == "" {
+			logrus.Fatal("watch requires --rules, or rules set in the [watch] table of the config")
+		}
+		rs, err := rules.Load(nil, watchRules)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		watchApply.Collision = collisionPolicy()
+		dest := watchApply.Dest
+		if dest == "" {
+			dest = rs.Dest
+		}
+		if watchApply.Trash == "" && watchApply.Journal != "" {
+			watchApply.Trash = watchApply.Journal + ".trash"
+		}
+		ignore := append([]string{dest, watchApply.Journal, watchApply.Trash}, rs.Dirs(dest)...)
+		for _, path := range ignore {
+			if path != "" {
+				watchOptions.Ignore = append(watchOptions.Ignore, path)
+			}
+		}
+
+		start := time.Now()
+		var total rules.Stats
+		err = watch.Watch(rootCtx, args[0], watchOptions, func(ctx context.Context, paths []string) []string {
+			result, err := rules.Apply(ctx, rs, paths, watchApply)
+			for _, o := range result.Outcomes {
+				emitOutcome(o)
+			}
+			total = total.Add(result.Stats())
+			if err != nil && ctx.Err() == nil {
+				logrus.Error(err)
+			}
+			return result.Done
+		})
+		total.Elapsed = time.Since(start)
+		finishRun(applySummary("watch", total))
+		checkInterrupted()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,184 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// Format is an archive format recognized by its magic bytes.
+type Format string
+
+const (
+	Unknown Format = ""
+	Zip     Format = "zip"
+	Tar     Format = "tar"
+	TarGz   Format = "tar.gz"
+	TarBz2  Format = "tar.bz2"
+	// Gzip and Bzip2 are single compressed files rather than archives.
+	Gzip  Format = "gz"
+	Bzip2 Format = "bz2"
+)
+
+// Single reports whether the format wraps exactly one file.
+func (f Format) Single() bool {
+	return f == Gzip || f == Bzip2
+}
+
+// EntryType is the kind of an archive entry.
+type EntryType int
+
+const (
+	TypeFile EntryType = iota
+	TypeDir
+	TypeSymlink
+	// TypeOther covers hard links, devices and fifos which are never extracted.
+	TypeOther
+)
+
+// Header describes the current entry of a Reader.
+type Header struct {
+	// Name is the raw entry name. When NonUTF8 is set it is in a legacy
+	// encoding the caller should decode with a Charset.
+	Name     string
+	NonUTF8  bool
+	Type     EntryType
+	Mode     os.FileMode
+	ModTime  time.Time
+	Linkname string
+	// Size is the uncompressed size, -1 when the format doesn't record it.
+	Size int64
+	// CompressedSize is the stored size, 0 when the format doesn't record it
+	// per entry.
+	CompressedSize int64
+	// CRC32 is only recorded by zip, HasCRC tells whether it is set.
+	CRC32  uint32
+	HasCRC bool
+}
+
+// Reader iterates the entries of an archive. Next advances to the next entry
+// and returns io.EOF at the end, Read reads the contents of the current entry.
+// The previous entry is released by each call to Next so only one entry is
+// ever open at a time.
+type Reader interface {
+	Next() (*Header, error)
+	io.Reader
+	Close() error
+}
+
+const (
+	sniffLen = 512
+	// tarMagicOffset is where "ustar" lives in a POSIX tar header.
+	tarMagicOffset = 257
+)
+
+// Detect identifies the format of the file at path.
+func Detect(fsys vfs.FS, path string) (Format, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return Unknown, errors.Wrap(err, "archive.Detect couldn't open file")
+	}
+	defer f.Close()
+
+	return DetectReader(f)
+}
+
+// DetectReader identifies the format of the stream in r by its magic bytes.
+// Compressed streams are peeked into to tell a tarball from a single file.
+func DetectReader(r io.Reader) (Format, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, _ := br.Peek(sniffLen)
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return Zip, nil
+	case isTar(head):
+		return Tar, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return Unknown, nil
+		}
+		defer gz.Close()
+		if isTar(peek(gz)) {
+			return TarGz, nil
+		}
+		return Gzip, nil
+	case bytes.HasPrefix(head, []byte("BZh")):
+		if isTar(peek(bzip2.NewReader(br))) {
+			return TarBz2, nil
+		}
+		return Bzip2, nil
+	}
+	return Unknown, nil
+}
+
+func peek(r io.Reader) []byte {
+	buf := make([]byte, sniffLen)
+	n, _ := io.ReadFull(r, buf)
+	return buf[:n]
+}
+
+func isTar(head []byte) bool {
+	return len(head) >= tarMagicOffset+5 && string(head[tarMagicOffset:tarMagicOffset+5]) == "ustar"
+}
+
+// Open detects the format of the archive at path and returns a Reader over it.
+func Open(fsys vfs.FS, path string) (Reader, Format, error) {
+	format, err := Detect(fsys, path)
+	if err != nil {
+		return nil, Unknown, err
+	}
+
+	var r Reader
+	switch format {
+	case Zip:
+		r, err = openZip(fsys, path)
+	case Tar, TarGz, TarBz2:
+		r, err = openTar(fsys, path, format)
+	case Gzip, Bzip2:
+		r, err = openSingle(fsys, path, format)
+	default:
+		return nil, Unknown, errors.Errorf("not a recognized archive: %s", path)
+	}
+	if err != nil {
+		return nil, format, errors.Wrapf(err, "couldn't open %s archive: %s", format, path)
+	}
+	return r, format, nil
+}
+
+var knownExts = []string{".tar.gz", ".tar.bz2", ".tgz", ".tbz2", ".tbz", ".zip", ".tar", ".gz", ".bz2"}
+
+// HasExt reports whether name ends in a known archive extension, case
+// insensitively. Only such files are worth sniffing with Detect when walking a
+// folder, office documents, epubs and jars are zips too but not archives to
+// be unpacked.
+func HasExt(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range knownExts {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrimExt strips a known archive extension, case insensitively, from name.
+func TrimExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range knownExts {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
@@ -0,0 +1,269 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+)
+
+// tempDir makes a folder for one test, call the returned func to remove it.
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func write(t *testing.T, path string, b []byte) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func zipOf(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		f, err := w.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(files[i+1]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarOf(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		hdr := &tar.Header{Name: files[i], Mode: 0644, Size: int64(len(files[i+1])), Typeflag: tar.TypeReg}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[i+1]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipOf(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	tests := []struct {
+		name string
+		body []byte
+		want Format
+	}{
+		{"a.zip", zipOf(t, "a.txt", "a"), Zip},
+		{"a.tar", tarOf(t, "a.txt", "a"), Tar},
+		{"a.tar.gz", gzipOf(t, tarOf(t, "a.txt", "a")), TarGz},
+		{"a.txt.gz", gzipOf(t, []byte("just text")), Gzip},
+		// The name doesn't count, only the content.
+		{"report.docx", zipOf(t, "document.xml", "<doc/>"), Zip},
+		{"a.zip.txt", []byte("PK but not quite"), Unknown},
+		{"empty", nil, Unknown},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		write(t, path, tt.body)
+		got, err := Detect(vfs.OS, path)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("%s detected as %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHasExt(t *testing.T) {
+	for name, want := range map[string]bool{
+		"a.zip": true, "A.ZIP": true, "a.tar": true, "a.tgz": true, "a.tar.gz": true,
+		"a.Tar.Bz2": true, "a.gz": true, "report.docx": false, "book.epub": false,
+		"app.jar": false, "zip": false, "a.zip.txt": false,
+	} {
+		if got := HasExt(name); got != want {
+			t.Errorf("HasExt(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestListAndTest(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "pack.tar.gz")
+	write(t, path, gzipOf(t, tarOf(t, "a.txt", "a", "sub/b.txt", "bb")))
+
+	headers, format, err := List(context.Background(), vfs.OS, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != TarGz || len(headers) != 2 || headers[0].Name != "a.txt" || headers[1].Name != "sub/b.txt" || headers[1].Size != 2 {
+		t.Errorf("listed %q %v", format, headers)
+	}
+
+	results, _, err := Test(context.Background(), vfs.OS, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if !r.OK() {
+			t.Errorf("%s: %s", r.Name, r.Err)
+		}
+	}
+	if len(results) != 2 || results[1].Read != 2 {
+		t.Errorf("tested %v", results)
+	}
+}
+
+func TestTestFindsCorruptEntries(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "pack.zip")
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.CreateHeader(&zip.FileHeader{Name: "a.txt", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("stored as is"))
+	w.Close()
+	// Flip a byte of the stored content, the CRC no longer matches.
+	b := buf.Bytes()
+	i := bytes.Index(b, []byte("stored as is"))
+	b[i] ^= 0xff
+	write(t, path, b)
+
+	results, _, err := Test(context.Background(), vfs.OS, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].OK() {
+		t.Errorf("corrupt entry passed: %v", results)
+	}
+}
+
+func TestCreateVolumes(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	var sources []Source
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(dir, name)
+		write(t, path, bytes.Repeat([]byte(name[:1]), 100))
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, Source{Path: path, Name: "in/" + name, Info: info})
+	}
+
+	out := filepath.Join(dir, "photos.zip")
+	names, err := Create(context.Background(), out, sources, CreateOptions{MaxSize: 250, Manifest: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "photos.part1.zip"), filepath.Join(dir, "photos.part2.zip")}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("wrote %v, want %v", names, want)
+	}
+
+	var entries []string
+	for _, name := range names {
+		results, _, err := Test(context.Background(), vfs.OS, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range results {
+			if !r.OK() {
+				t.Errorf("%s!%s: %s", name, r.Name, r.Err)
+			}
+			entries = append(entries, r.Name)
+		}
+	}
+	if want := []string{"in/a.txt", "in/b.txt", ManifestName, "in/c.txt", ManifestName}; !reflect.DeepEqual(entries, want) {
+		t.Errorf("volumes hold %v, want %v", entries, want)
+	}
+}
+
+func TestZipModTime(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	// An extended timestamp is recorded with the MS-DOS time when Modified
+	// is set and is read back to the second.
+	when := time.Date(2017, 10, 19, 14, 30, 5, 0, time.UTC)
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	if _, err := w.CreateHeader(&zip.FileHeader{Name: "a.txt", Modified: when}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	path := filepath.Join(dir, "pack.zip")
+	write(t, path, buf.Bytes())
+
+	headers, _, err := List(context.Background(), vfs.OS, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 1 || !headers[0].ModTime.Equal(when) {
+		t.Errorf("listed %v, want modified at %s", headers, when)
+	}
+}
+
+func TestCharsetDecode(t *testing.T) {
+	tests := []struct {
+		charset, raw, want string
+	}{
+		{"cp437", "caf\x82.txt", "café.txt"},
+		{"ibm437", "\x9c5", "£5"},
+		{"latin1", "caf\xe9.txt", "café.txt"},
+		{"cp1252", "\x80 \x93quoted\x94", "€ “quoted”"},
+		{"shift_jis", "\x93\xfa\x96\x7b.txt", "日本.txt"},
+		{"sjis", "\xb1\xb2", "ｱｲ"},
+		// Names that already are UTF-8 are left alone.
+		{"cp437", "café.txt", "café.txt"},
+	}
+	for _, tt := range tests {
+		c, err := LookupCharset(tt.charset)
+		if err != nil {
+			t.Errorf("%s: %s", tt.charset, err)
+			continue
+		}
+		if got := c.Decode(tt.raw); got != tt.want {
+			t.Errorf("%s decoded %q as %q, want %q", tt.charset, tt.raw, got, tt.want)
+		}
+	}
+	if _, err := LookupCharset("ebcdic"); err == nil {
+		t.Error("unknown charset was found")
+	}
+}
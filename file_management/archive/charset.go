@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Charset decodes entry names stored in a legacy, non UTF-8 encoding.
+type Charset struct {
+	Name   string
+	decode func(s string) string
+}
+
+// Decode converts s to UTF-8. Strings that are already valid UTF-8 are
+// returned untouched.
+func (c Charset) Decode(s string) string {
+	if c.decode == nil || utf8.ValidString(s) {
+		return s
+	}
+	return c.decode(s)
+}
+
+// DefaultCharset is what the zip specification mandates for names without the
+// UTF-8 flag.
+var DefaultCharset = Charset{Name: "cp437", decode: decodeHigh(cp437High)}
+
+var charsets = map[string]Charset{
+	"cp437":        DefaultCharset,
+	"latin1":       {Name: "latin1", decode: decodeLatin1},
+	"windows-1252": {Name: "windows-1252", decode: decodeHigh(windows1252High)},
+	"shift-jis":    {Name: "shift-jis", decode: decodeCP932},
+}
+
+var charsetAliases = map[string]string{
+	"ibm437":      "cp437",
+	"iso-8859-1":  "latin1",
+	"cp1252":      "windows-1252",
+	"sjis":        "shift-jis",
+	"shift_jis":   "shift-jis",
+	"cp932":       "shift-jis",
+	"windows-31j": "shift-jis",
+}
+
+// LookupCharset finds a charset by name or common alias.
+func LookupCharset(name string) (Charset, error) {
+	name = strings.ToLower(name)
+	if alias, ok := charsetAliases[name]; ok {
+		name = alias
+	}
+	if c, ok := charsets[name]; ok {
+		return c, nil
+	}
+	return Charset{}, errors.Errorf("unknown charset: %s, expected one of %s", name, strings.Join(CharsetNames(), ", "))
+}
+
+// CharsetNames lists the supported charsets.
+func CharsetNames() []string {
+	names := make([]string, 0, len(charsets))
+	for name := range charsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func decodeLatin1(s string) string {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
+
+// decodeHigh builds a decoder for single byte code pages that are ASCII below
+// 0x80, high holds the runes for 0x80 to 0xFF.
+func decodeHigh(high string) func(string) string {
+	table := []rune(high)
+	return func(s string) string {
+		runes := make([]rune, len(s))
+		for i := 0; i < len(s); i++ {
+			if b := s[i]; b < 0x80 {
+				runes[i] = rune(b)
+			} else {
+				runes[i] = table[b-0x80]
+			}
+		}
+		return string(runes)
+	}
+}
+
+const cp932Trails = 0xFD - 0x40
+
+var cp932Table = []rune(cp932Double)
+
+func cp932Lead(b byte) (int, bool) {
+	switch {
+	case b >= 0x81 && b <= 0x9F:
+		return int(b - 0x81), true
+	case b >= 0xE0 && b <= 0xFC:
+		return int(b-0xE0) + 0x9F - 0x81 + 1, true
+	}
+	return 0, false
+}
+
+func decodeCP932(s string) string {
+	runes := make([]rune, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case b < 0x80:
+			runes = append(runes, rune(b))
+		case b >= 0xA1 && b <= 0xDF:
+			// Half width katakana.
+			runes = append(runes, 0xFF61+rune(b-0xA1))
+		default:
+			lead, ok := cp932Lead(b)
+			if !ok || i+1 >= len(s) || s[i+1] < 0x40 || s[i+1] > 0xFC {
+				runes = append(runes, utf8.RuneError)
+				continue
+			}
+			runes = append(runes, cp932Table[lead*cp932Trails+int(s[i+1]-0x40)])
+			i++
+		}
+	}
+	return string(runes)
+}
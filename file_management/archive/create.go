@@ -0,0 +1,321 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/logging"
+	md5 "github.com/deckarep/gorganize/file_management/md5"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// ManifestName is the entry holding the md5 of every other entry, in the
+// format understood by md5sum -c.
+const ManifestName = "MANIFEST.md5"
+
+// Source is a file to add to an archive under Name.
+type Source struct {
+	Path string
+	Name string
+	Info os.FileInfo
+}
+
+// EntryName names the file at p, found below root, inside an archive. Names
+// start with the base name of root so folders keep their name, relative roots
+// such as "." or ".." are made absolute first. Names leaving the archive are
+// an error.
+func EntryName(root, p string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", errors.Wrap(err, "archive.EntryName couldn't resolve root")
+	}
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		return "", errors.Wrap(err, "archive.EntryName couldn't resolve path")
+	}
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil {
+		return "", errors.Wrap(err, "archive.EntryName couldn't name path")
+	}
+	if rel = filepath.ToSlash(rel); rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", errors.Errorf("%s isn't below %s", p, root)
+	}
+	name := path.Join(filepath.Base(absRoot), rel)
+	if path.IsAbs(name) {
+		return "", errors.Errorf("%s would be named %s, outside of the archive", p, name)
+	}
+	return name, nil
+}
+
+// CreateOptions controls archive creation.
+type CreateOptions struct {
+	// MaxSize splits the archive into volumes of roughly at most MaxSize
+	// bytes, each a standalone archive. 0 writes a single archive.
+	MaxSize int64
+	// Manifest embeds a MANIFEST.md5 of the volume's files. A source named
+	// like the manifest is then an error.
+	Manifest bool
+	Logger   logging.Logger
+	// FS is where sources are read and volumes written, it defaults to vfs.OS.
+	FS vfs.FS
+}
+
+// storedExts are formats that are already compressed, deflating them again
+// costs time for no gain.
+var storedExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".heic": true,
+	".mp4": true, ".mov": true, ".avi": true, ".mkv": true, ".mp3": true, ".m4a": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".7z": true, ".rar": true,
+}
+
+// FormatForName picks the archive format from the output file name.
+func FormatForName(name string) (Format, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return Zip, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return TarGz, nil
+	}
+	return Unknown, errors.Errorf("can only create .zip or .tar.gz archives, got: %s", name)
+}
+
+// Create packs sources into the archive out, or into numbered volumes next to
+// it when MaxSize requires more than one. It returns the paths written.
+func Create(ctx context.Context, out string, sources []Source, opts CreateOptions) ([]string, error) {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	format, err := FormatForName(out)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Manifest {
+		for _, src := range sources {
+			// Archives extracted on case insensitive filesystems would
+			// still clash.
+			if strings.EqualFold(src.Name, ManifestName) {
+				return nil, errors.Errorf("%s would clash with the generated %s, exclude it or drop the manifest", src.Path, ManifestName)
+			}
+		}
+	}
+
+	volumes := planVolumes(sources, opts.MaxSize, log)
+	names := volumeNames(out, len(volumes))
+
+	for i, volume := range volumes {
+		if err := ctx.Err(); err != nil {
+			return names[:i], err
+		}
+
+		var manifest []byte
+		if opts.Manifest {
+			if manifest, err = buildManifest(ctx, fsys, volume); err != nil {
+				return names[:i], err
+			}
+		}
+
+		if err := writeVolume(ctx, fsys, names[i], format, volume, manifest); err != nil {
+			fsys.Remove(names[i])
+			return names[:i], errors.Wrapf(err, "couldn't write archive: %s", names[i])
+		}
+		log.Infof("Created archive: %s (%d files)", names[i], len(volume))
+	}
+	return names, nil
+}
+
+// planVolumes greedily packs sources, in order, into volumes whose total
+// uncompressed size stays under maxSize. A single file larger than maxSize
+// gets a volume of its own.
+func planVolumes(sources []Source, maxSize int64, log logging.Logger) [][]Source {
+	if maxSize <= 0 {
+		return [][]Source{sources}
+	}
+
+	var volumes [][]Source
+	var current []Source
+	var size int64
+	for _, src := range sources {
+		if len(current) > 0 && size+src.Info.Size() > maxSize {
+			volumes = append(volumes, current)
+			current, size = nil, 0
+		}
+		if src.Info.Size() > maxSize {
+			log.Warnf("File is larger than --max-size, it gets a volume of its own: %s", src.Path)
+		}
+		current = append(current, src)
+		size += src.Info.Size()
+	}
+	if len(current) > 0 || len(volumes) == 0 {
+		volumes = append(volumes, current)
+	}
+	return volumes
+}
+
+// volumeNames returns out itself for a single volume, otherwise out with a
+// part number inserted before the extension: photos.part1.zip.
+func volumeNames(out string, count int) []string {
+	if count == 1 {
+		return []string{out}
+	}
+
+	dir, base := filepath.Split(out)
+	stem := TrimExt(base)
+	ext := base[len(stem):]
+
+	names := make([]string, count)
+	for i := range names {
+		names[i] = filepath.Join(dir, fmt.Sprintf("%s.part%d%s", stem, i+1, ext))
+	}
+	return names
+}
+
+func buildManifest(ctx context.Context, fsys vfs.FS, sources []Source) ([]byte, error) {
+	producerChan, receiverChan := md5.PSum(ctx, fsys, 0, nil)
+
+	go func() {
+		for _, src := range sources {
+			producerChan <- src.Path
+		}
+		close(producerChan)
+	}()
+
+	hashes := make(map[string]md5.SumValue, len(sources))
+	for result := range receiverChan {
+		hashes[result.Name] = result
+	}
+
+	lines := make([]string, 0, len(sources))
+	for _, src := range sources {
+		hash := hashes[src.Path]
+		if hash.Err != nil {
+			return nil, errors.Wrapf(hash.Err, "couldn't hash file for manifest: %s", src.Path)
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s\n", hash.Hash, src.Name))
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "")), nil
+}
+
+func writeVolume(ctx context.Context, fsys vfs.FS, out string, format Format, sources []Source, manifest []byte) error {
+	f, err := vfs.Create(fsys, out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := bufio.NewWriter(f)
+	switch format {
+	case Zip:
+		err = writeZip(ctx, fsys, buf, sources, manifest)
+	case TarGz:
+		err = writeTarGz(ctx, fsys, buf, sources, manifest)
+	}
+	if err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeZip(ctx context.Context, fsys vfs.FS, w io.Writer, sources []Source, manifest []byte) error {
+	zw := zip.NewWriter(w)
+	for _, src := range sources {
+		// Stopping between files, the partial volume is removed by Create.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(src.Info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = src.Name
+		hdr.Method = zip.Deflate
+		if storedExts[strings.ToLower(path.Ext(src.Name))] {
+			hdr.Method = zip.Store
+		}
+
+		entry, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if err := copyFile(fsys, entry, src.Path); err != nil {
+			return err
+		}
+	}
+
+	if manifest != nil {
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: ManifestName, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(manifest); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeTarGz compresses the whole stream, tar.gz can't leave individual
+// entries uncompressed.
+func writeTarGz(ctx context.Context, fsys vfs.FS, w io.Writer, sources []Source, manifest []byte) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, src := range sources {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(src.Info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = src.Name
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := copyFile(fsys, tw, src.Path); err != nil {
+			return err
+		}
+	}
+
+	if manifest != nil {
+		hdr := &tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(manifest)), Typeflag: tar.TypeReg, ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(manifest); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func copyFile(fsys vfs.FS, w io.Writer, path string) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,43 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEntryName(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := filepath.Dir(wd)
+	tests := []struct {
+		root, path, want string
+	}{
+		{"photos", "photos/2017/a.jpg", "photos/2017/a.jpg"},
+		{"photos/", "photos/a.jpg", "photos/a.jpg"},
+		{"a.jpg", "a.jpg", "a.jpg"},
+		{"/srv/in", "/srv/in/f.txt", "in/f.txt"},
+		// Relative roots are named after the folder they point to.
+		{".", "f.txt", filepath.Base(wd) + "/f.txt"},
+		{"..", filepath.Join("..", filepath.Base(wd), "f.txt"), filepath.Base(parent) + "/" + filepath.Base(wd) + "/f.txt"},
+	}
+	for _, tt := range tests {
+		got, err := EntryName(tt.root, tt.path)
+		if err != nil {
+			t.Errorf("EntryName(%q, %q): %s", tt.root, tt.path, err)
+		} else if got != tt.want {
+			t.Errorf("EntryName(%q, %q) = %q, want %q", tt.root, tt.path, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ root, path string }{
+		{"/", "/etc/passwd"},
+		{"/srv/in", "/srv/out/f.txt"},
+	} {
+		if name, err := EntryName(tt.root, tt.path); err == nil {
+			t.Errorf("EntryName(%q, %q) = %q, want an error", tt.root, tt.path, name)
+		}
+	}
+}
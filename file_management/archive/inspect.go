@@ -0,0 +1,160 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// Ratio is the entry's uncompressed to compressed size ratio, 0 when the
+// format doesn't record sizes per entry.
+func (h *Header) Ratio() float64 {
+	if h.CompressedSize <= 0 || h.Size < 0 {
+		return 0
+	}
+	return float64(h.Size) / float64(h.CompressedSize)
+}
+
+// List returns the headers of every entry in the archive at path without
+// extracting anything. It stops between entries once ctx is done.
+func List(ctx context.Context, fsys vfs.FS, path string) ([]*Header, Format, error) {
+	r, format, err := Open(fsys, path)
+	if err != nil {
+		return nil, format, err
+	}
+	defer r.Close()
+
+	var headers []*Header
+	for {
+		if err := ctx.Err(); err != nil {
+			return headers, format, err
+		}
+		hdr, err := r.Next()
+		if err == io.EOF {
+			return headers, format, nil
+		}
+		if err != nil {
+			return headers, format, errors.Wrapf(err, "couldn't read entry of: %s", path)
+		}
+		headers = append(headers, hdr)
+	}
+}
+
+// TestResult is the outcome of reading back a single entry.
+type TestResult struct {
+	*Header
+	// Read is how many bytes were actually decompressed.
+	Read int64
+	// Checksum is the CRC32 of the decompressed content.
+	Checksum uint32
+	// MD5 is the hex md5 of the decompressed content.
+	MD5 string
+	Err error
+}
+
+// OK reports whether the entry could be read back and, when the format
+// records one, matched its CRC.
+func (t TestResult) OK() bool {
+	return t.Err == nil
+}
+
+// Test reads every entry of the archive at path, verifying its CRC where the
+// format records one, without writing anything to disk. When the archive
+// embeds a MANIFEST.md5 every entry is also checked against it. A corrupt
+// stream stops the test since later entries can't be reached, so does ctx
+// being done.
+func Test(ctx context.Context, fsys vfs.FS, path string) ([]TestResult, Format, error) {
+	r, format, err := Open(fsys, path)
+	if err != nil {
+		return nil, format, err
+	}
+	defer r.Close()
+
+	var results []TestResult
+	var manifest []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return results, format, err
+		}
+		hdr, err := r.Next()
+		if err == io.EOF {
+			return checkManifest(results, manifest), format, nil
+		}
+		if err != nil {
+			return results, format, errors.Wrapf(err, "couldn't read entry of: %s", path)
+		}
+
+		result := TestResult{Header: hdr}
+		if hdr.Type == TypeFile {
+			h, m := crc32.NewIEEE(), md5.New()
+			var content io.Writer = ioutil.Discard
+			var buf bytes.Buffer
+			if hdr.Name == ManifestName {
+				content = &buf
+			}
+			result.Read, result.Err = io.Copy(io.MultiWriter(content, h, m), r)
+			result.Checksum = h.Sum32()
+			result.MD5 = hex.EncodeToString(m.Sum(nil))
+			if hdr.Name == ManifestName {
+				manifest = buf.Bytes()
+			}
+			if result.Err == nil && hdr.HasCRC && result.Checksum != hdr.CRC32 {
+				result.Err = errors.Errorf("crc mismatch, expected %08x got %08x", hdr.CRC32, result.Checksum)
+			}
+			if result.Err == nil && hdr.Size >= 0 && result.Read != hdr.Size {
+				result.Err = errors.Errorf("size mismatch, expected %d got %d", hdr.Size, result.Read)
+			}
+		}
+		results = append(results, result)
+	}
+}
+
+// checkManifest marks entries whose md5 doesn't match the manifest and adds a
+// failed result for every manifest line without a matching entry.
+func checkManifest(results []TestResult, manifest []byte) []TestResult {
+	if manifest == nil {
+		return results
+	}
+
+	expected := make(map[string]string)
+	for _, line := range strings.Split(string(manifest), "\n") {
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) == 2 {
+			expected[parts[1]] = parts[0]
+		}
+	}
+
+	for i := range results {
+		result := &results[i]
+		hash, ok := expected[result.Name]
+		if !ok {
+			continue
+		}
+		delete(expected, result.Name)
+		if result.Err == nil && result.MD5 != hash {
+			result.Err = errors.Errorf("md5 mismatch with manifest, expected %s got %s", hash, result.MD5)
+		}
+	}
+
+	missing := make([]string, 0, len(expected))
+	for name := range expected {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		results = append(results, TestResult{
+			Header: &Header{Name: name, Size: -1},
+			Err:    errors.New("listed in manifest but missing from archive"),
+		})
+	}
+	return results
+}
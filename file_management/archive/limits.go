@@ -0,0 +1,102 @@
+package archive
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLimitExceeded is returned when an archive exceeds the extraction Limits.
+var ErrLimitExceeded = errors.New("archive exceeds extraction limits")
+
+// Limits caps what a single archive may expand to. Zero values disable the
+// corresponding check.
+type Limits struct {
+	// MaxBytes is the total uncompressed size of all entries.
+	MaxBytes int64
+	// MaxEntries is the number of entries in the archive.
+	MaxEntries int
+	// MaxRatio is the uncompressed to compressed size ratio of any entry, and
+	// of the archive as a whole for formats that compress the entire stream.
+	MaxRatio float64
+}
+
+// DefaultLimits are generous enough for photo deliveries while still stopping
+// zip bombs.
+var DefaultLimits = Limits{
+	MaxBytes:   20 << 30,
+	MaxEntries: 100000,
+	MaxRatio:   200,
+}
+
+// ratioFloor is how much an archive may expand to before the archive wide
+// ratio check kicks in, tiny archives of text legitimately compress very well.
+const ratioFloor = 1 << 20
+
+// Budget tracks what an archive has expanded to so far against its Limits.
+type Budget struct {
+	limits      Limits
+	archiveSize int64
+	entries     int
+	produced    int64
+}
+
+// NewBudget starts the budget of an archive taking archiveSize bytes on disk.
+func NewBudget(limits Limits, archiveSize int64) *Budget {
+	return &Budget{limits: limits, archiveSize: archiveSize}
+}
+
+// Entry counts one more entry against the limit.
+func (b *Budget) Entry() error {
+	b.entries++
+	if b.limits.MaxEntries > 0 && b.entries > b.limits.MaxEntries {
+		return errors.Wrapf(ErrLimitExceeded, "archive has more than %d entries", b.limits.MaxEntries)
+	}
+	return nil
+}
+
+// Admit checks an entry's declared sizes before anything is written. Formats
+// that don't record a size per entry pass -1 and 0, the actual output is still
+// held to the limits by Reader.
+func (b *Budget) Admit(name string, compressed, uncompressed int64) error {
+	if b.limits.MaxRatio > 0 && uncompressed > 0 && compressed > 0 {
+		if float64(uncompressed)/float64(compressed) > b.limits.MaxRatio {
+			return errors.Wrapf(ErrLimitExceeded, "entry %s compression ratio exceeds %.0f", name, b.limits.MaxRatio)
+		}
+	}
+	if b.limits.MaxBytes > 0 && uncompressed > b.limits.MaxBytes-b.produced {
+		return errors.Wrapf(ErrLimitExceeded, "entry %s would exceed %d total bytes", name, b.limits.MaxBytes)
+	}
+	return nil
+}
+
+// Reader wraps r so the actual bytes produced, not just the declared header
+// sizes, are held to the budget.
+func (b *Budget) Reader(r io.Reader) io.Reader {
+	return &budgetReader{r: r, b: b}
+}
+
+func (b *Budget) check() error {
+	if b.limits.MaxBytes > 0 && b.produced > b.limits.MaxBytes {
+		return errors.Wrapf(ErrLimitExceeded, "archive expands past %d total bytes", b.limits.MaxBytes)
+	}
+	if b.limits.MaxRatio > 0 && b.archiveSize > 0 && b.produced > ratioFloor &&
+		float64(b.produced)/float64(b.archiveSize) > b.limits.MaxRatio {
+		return errors.Wrapf(ErrLimitExceeded, "archive compression ratio exceeds %.0f", b.limits.MaxRatio)
+	}
+	return nil
+}
+
+type budgetReader struct {
+	r io.Reader
+	b *Budget
+}
+
+func (br *budgetReader) Read(p []byte) (int, error) {
+	n, err := br.r.Read(p)
+	br.b.produced += int64(n)
+	if limitErr := br.b.check(); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
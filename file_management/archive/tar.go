@@ -0,0 +1,147 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+)
+
+type tarReader struct {
+	f  vfs.File
+	gz *gzip.Reader
+	tr *tar.Reader
+}
+
+func openTar(fsys vfs.FS, path string, format Format) (Reader, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tarReader{f: f}
+	var r io.Reader = f
+	switch format {
+	case TarGz:
+		if t.gz, err = gzip.NewReader(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		r = t.gz
+	case TarBz2:
+		r = bzip2.NewReader(f)
+	}
+	t.tr = tar.NewReader(r)
+	return t, nil
+}
+
+func (t *tarReader) Next() (*Header, error) {
+	th, err := t.tr.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := &Header{
+		Name:     th.Name,
+		NonUTF8:  !utf8.ValidString(th.Name),
+		Mode:     os.FileMode(th.Mode).Perm(),
+		ModTime:  th.ModTime,
+		Linkname: th.Linkname,
+		Size:     th.Size,
+	}
+	switch th.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		hdr.Type = TypeFile
+	case tar.TypeDir:
+		hdr.Type = TypeDir
+	case tar.TypeSymlink:
+		hdr.Type = TypeSymlink
+	default:
+		hdr.Type = TypeOther
+	}
+	return hdr, nil
+}
+
+func (t *tarReader) Read(p []byte) (int, error) {
+	return t.tr.Read(p)
+}
+
+func (t *tarReader) Close() error {
+	if t.gz != nil {
+		t.gz.Close()
+	}
+	return t.f.Close()
+}
+
+// singleReader exposes a lone gzip or bzip2 compressed file as an archive
+// with one entry.
+type singleReader struct {
+	f    vfs.File
+	gz   *gzip.Reader
+	r    io.Reader
+	hdr  *Header
+	done bool
+}
+
+func openSingle(fsys vfs.FS, path string, format Format) (Reader, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s := &singleReader{f: f}
+	s.hdr = &Header{
+		Name:    TrimExt(filepath.Base(path)),
+		Mode:    0666,
+		ModTime: info.ModTime(),
+		Size:    -1,
+	}
+
+	switch format {
+	case Gzip:
+		if s.gz, err = gzip.NewReader(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		// Prefer the original name recorded by gzip when it is a plain name.
+		if name := s.gz.Name; name != "" && filepath.Base(name) == name {
+			s.hdr.Name = name
+		}
+		if !s.gz.ModTime.IsZero() {
+			s.hdr.ModTime = s.gz.ModTime
+		}
+		s.r = s.gz
+	case Bzip2:
+		s.r = bzip2.NewReader(f)
+	}
+	return s, nil
+}
+
+func (s *singleReader) Next() (*Header, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	s.done = true
+	return s.hdr, nil
+}
+
+func (s *singleReader) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func (s *singleReader) Close() error {
+	if s.gz != nil {
+		s.gz.Close()
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,128 @@
+package archive
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+)
+
+type zipReader struct {
+	f       vfs.File
+	zr      *zip.Reader
+	next    int
+	current io.ReadCloser
+	// err is why the current entry can't be read, a damaged entry doesn't
+	// stop the rest of the archive from being listed.
+	err error
+}
+
+func openZip(fsys vfs.FS, path string) (Reader, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	zr, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &zipReader{f: f, zr: zr}, nil
+}
+
+func (z *zipReader) Next() (*Header, error) {
+	z.release()
+	if z.next >= len(z.zr.File) {
+		return nil, io.EOF
+	}
+	file := z.zr.File[z.next]
+	z.next++
+
+	hdr := &Header{
+		Name: file.Name,
+		// Bit 11 promises UTF-8 names, without it the name is in whatever
+		// code page the creator used.
+		NonUTF8:        file.Flags&0x800 == 0 && !utf8.ValidString(file.Name),
+		Mode:           file.Mode().Perm(),
+		ModTime:        zipModTime(file),
+		Size:           int64(file.UncompressedSize64),
+		CompressedSize: int64(file.CompressedSize64),
+		CRC32:          file.CRC32,
+		HasCRC:         true,
+	}
+	switch {
+	case file.FileInfo().IsDir():
+		hdr.Type = TypeDir
+	case file.Mode()&os.ModeSymlink != 0:
+		hdr.Type = TypeSymlink
+	case !file.Mode().IsRegular():
+		hdr.Type = TypeOther
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		z.err = err
+		return hdr, nil
+	}
+	z.current = rc
+
+	if hdr.Type == TypeSymlink {
+		// Zip stores the link target as the entry content.
+		target, err := readLinkname(rc)
+		if err != nil {
+			z.err = err
+			return hdr, nil
+		}
+		hdr.Linkname = target
+	}
+	return hdr, nil
+}
+
+func (z *zipReader) Read(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.current == nil {
+		return 0, io.EOF
+	}
+	return z.current.Read(p)
+}
+
+func (z *zipReader) release() {
+	if z.current != nil {
+		z.current.Close()
+		z.current = nil
+	}
+	z.err = nil
+}
+
+func (z *zipReader) Close() error {
+	z.release()
+	return z.f.Close()
+}
+
+func readLinkname(r io.Reader) (string, error) {
+	buf := make([]byte, 4096)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+// zipModTime returns the modification time recorded for file, the extended
+// timestamp or NTFS time when present, otherwise the MS-DOS one.
+func zipModTime(file *zip.File) time.Time {
+	if !file.Modified.IsZero() {
+		return file.Modified
+	}
+	return file.ModTime()
+}
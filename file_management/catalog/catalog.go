@@ -0,0 +1,371 @@
+// Package catalog keeps a local index of files, so they can be found while
+// the drives holding them are offline. Roots are indexed one at a time and
+// re-indexing only hashes the files whose size or modification time changed.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/archive"
+	"github.com/deckarep/gorganize/file_management/logging"
+	md5 "github.com/deckarep/gorganize/file_management/md5"
+	"github.com/deckarep/gorganize/file_management/meta"
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/deckarep/gorganize/file_management/progress"
+	"github.com/deckarep/gorganize/file_management/tags"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// version is the format of the catalog file.
+const version = 1
+
+// Entry is a file as it was last indexed.
+type Entry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	MD5     string    `json:"md5"`
+	// Type is the category of the file, "archive" for archives recognized by
+	// their content, "other" for everything else.
+	Type string `json:"type"`
+	// Taken is when the media was captured, or the modification time.
+	Taken  time.Time `json:"taken"`
+	Camera string    `json:"camera,omitempty"`
+	Tags   []string  `json:"tags,omitempty"`
+}
+
+// Root is a folder that was indexed.
+type Root struct {
+	Path    string    `json:"path"`
+	Indexed time.Time `json:"indexed"`
+	Files   int       `json:"files"`
+	// Device identifies the file system the root was on, 0 when unknown.
+	Device uint64 `json:"device,omitempty"`
+}
+
+// Catalog is the index of every root's files.
+type Catalog struct {
+	Roots []Root
+	files map[string]*Entry
+}
+
+// file is the on disk shape of a catalog.
+type file struct {
+	Version int      `json:"version"`
+	Roots   []Root   `json:"roots"`
+	Files   []*Entry `json:"files"`
+}
+
+// DefaultPath is where the catalog is kept by default, in the XDG data dir.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return filepath.Join(dir, "gorganize", "catalog.json")
+}
+
+// Open reads the catalog at path on fsys, a missing one is empty.
+func Open(fsys vfs.FS, path string) (*Catalog, error) {
+	c := &Catalog{files: make(map[string]*Entry)}
+	b, err := vfs.ReadFile(vfs.Or(fsys), path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read catalog")
+	}
+
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, errors.Wrapf(err, "corrupt catalog: %s", path)
+	}
+	if f.Version != version {
+		return nil, errors.Errorf("catalog %s has version %d, expected %d", path, f.Version, version)
+	}
+	c.Roots = f.Roots
+	for _, e := range f.Files {
+		c.files[e.Path] = e
+	}
+	return c, nil
+}
+
+// Save writes the catalog to path on fsys.
+func (c *Catalog) Save(fsys vfs.FS, path string) error {
+	fsys = vfs.Or(fsys)
+	f := file{Version: version, Roots: c.Roots, Files: c.Entries()}
+	b, err := json.Marshal(f)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode catalog")
+	}
+	if err := fsys.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return errors.Wrap(err, "couldn't create catalog dir")
+	}
+	tmp := path + ".gorganize-tmp"
+	if err := vfs.WriteFile(fsys, tmp, b, 0666); err != nil {
+		fsys.Remove(tmp)
+		return errors.Wrap(err, "couldn't write catalog")
+	}
+	return errors.Wrap(fsys.Rename(tmp, path), "couldn't move catalog into place")
+}
+
+// Entries lists every file, sorted by path.
+func (c *Catalog) Entries() []*Entry {
+	entries := make([]*Entry, 0, len(c.files))
+	for _, e := range c.files {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// Find lists the files matching q, sorted by path. Nothing on disk is read.
+func (c *Catalog) Find(q *Query) []*Entry {
+	var found []*Entry
+	for _, e := range c.Entries() {
+		if q.Match(e) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// IndexOptions controls Index.
+type IndexOptions struct {
+	Logger logging.Logger
+	FS     vfs.FS
+	// Progress receives progress events for the files being hashed, nil
+	// reports nothing.
+	Progress progress.Reporter
+	// Force indexes a root even when its drive looks unmounted: the root is
+	// on another device than last time, or it is empty while the catalog
+	// holds files below it.
+	Force bool
+}
+
+// IndexResult is what Index changed in the catalog.
+type IndexResult struct {
+	Added     []*Entry
+	Updated   []*Entry
+	Removed   []string
+	Unchanged int
+	Failed    int
+	// Bytes is the size of the files hashed.
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// Index brings the entries below root up to date. Files whose size and
+// modification time are unchanged keep their hash and metadata, files gone
+// from root are removed. A root that can't be reached is an error and its
+// entries are kept. So is a root that looks like the empty mountpoint of an
+// unplugged drive, unless opts.Force is set. When ctx is done the files
+// indexed so far are kept but nothing is removed.
+func (c *Catalog) Index(ctx context.Context, root string, opts IndexOptions) (*IndexResult, error) {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	result := &IndexResult{}
+	start := time.Now()
+	defer func() { result.Elapsed = time.Since(start) }()
+	tracker := progress.NewTracker("index", opts.Progress)
+	defer tracker.Done()
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return result, errors.Wrap(err, "couldn't resolve root")
+	}
+	info, err := fsys.Stat(root)
+	if err != nil {
+		return result, errors.Wrapf(err, "root %s can't be reached, its entries are kept", root)
+	}
+	device := deviceOf(info)
+	if prev, ok := c.root(root); ok && !opts.Force && prev.Device != 0 && device != 0 && prev.Device != device {
+		return result, errors.Errorf("root %s is on another device than when it was indexed, is its drive mounted? Its entries are kept, force indexing to replace them", root)
+	}
+
+	seen := make(map[string]bool)
+	// unreadable folders keep their entries, the files may well still be there.
+	var unreadable []string
+	dirTags := make(map[string]map[string][]string)
+	var changed []*Entry
+	err = vfs.Walk(fsys, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Warnf("Couldn't index %s: %s", path, err)
+			unreadable = append(unreadable, path)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := info.Name()
+		if !info.Mode().IsRegular() || name == tags.FileName || strings.HasSuffix(name, ".gorganize-tmp") {
+			return nil
+		}
+		seen[path] = true
+
+		dir := filepath.Dir(path)
+		if _, ok := dirTags[dir]; !ok {
+			if dirTags[dir], err = tags.Dir(fsys, dir); err != nil {
+				log.Warnf("%s", err)
+			}
+		}
+		fileTags := dirTags[dir][name]
+
+		if e, ok := c.files[path]; ok && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) {
+			// Tags live next to the file, changing them doesn't touch it.
+			e.Tags = fileTags
+			result.Unchanged++
+			return nil
+		}
+		changed = append(changed, &Entry{Path: path, Size: info.Size(), ModTime: info.ModTime(), Tags: fileTags})
+		tracker.Discovered(1, info.Size())
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		return result, errors.Wrapf(err, "couldn't walk: %s", root)
+	}
+
+	byPath := make(map[string]*Entry, len(changed))
+	producerChan, receiverChan := md5.PSum(ctx, fsys, 0, tracker)
+	go func() {
+		for _, e := range changed {
+			producerChan <- e.Path
+		}
+		close(producerChan)
+	}()
+	for _, e := range changed {
+		byPath[e.Path] = e
+	}
+	for sum := range receiverChan {
+		e := byPath[sum.Name]
+		if sum.Err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("Couldn't index %s: %s", sum.Name, sum.Err)
+				result.Failed++
+			}
+			continue
+		}
+		e.MD5 = sum.Hash
+		describe(fsys, e, log)
+
+		if _, ok := c.files[e.Path]; ok {
+			result.Updated = append(result.Updated, e)
+		} else {
+			result.Added = append(result.Added, e)
+		}
+		result.Bytes += e.Size
+		c.files[e.Path] = e
+	}
+	sortEntries(result.Added)
+	sortEntries(result.Updated)
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if len(seen) == 0 && !opts.Force {
+		if n := c.count(root); n > 0 {
+			return result, errors.Errorf("root %s is empty but held %d file(s), is its drive mounted? Its entries are kept, force indexing to remove them", root, n)
+		}
+	}
+
+	for path := range c.files {
+		if below(path, root) && !seen[path] && !belowAny(path, unreadable) {
+			delete(c.files, path)
+			result.Removed = append(result.Removed, path)
+		}
+	}
+	sort.Strings(result.Removed)
+	c.addRoot(root, device)
+	return result, nil
+}
+
+// describe fills in the type and metadata of e.
+func describe(fsys vfs.FS, e *Entry, log logging.Logger) {
+	e.Type = typeOf(fsys, e.Path)
+	info, err := meta.Read(fsys, e.Path)
+	if err != nil {
+		log.Warnf("Couldn't read metadata of %s: %s", e.Path, err)
+		e.Taken = e.ModTime
+		return
+	}
+	e.Taken, e.Camera = info.Taken, info.Camera
+}
+
+// typeOf names the category of path by its extension, or "archive" by its
+// content.
+func typeOf(fsys vfs.FS, path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, name := range op.CategoryNames() {
+		if name == "all" {
+			continue
+		}
+		if set, _ := op.CategoryExtensions(name); set.Contains(ext) {
+			return name
+		}
+	}
+	if format, err := archive.Detect(fsys, path); err == nil && format != archive.Unknown {
+		return "archive"
+	}
+	return "other"
+}
+
+// addRoot records that root, on device, was just indexed. Roots inside it are
+// now covered by it.
+func (c *Catalog) addRoot(root string, device uint64) {
+	r := Root{Path: root, Indexed: time.Now(), Files: c.count(root), Device: device}
+
+	roots := []Root{r}
+	for _, existing := range c.Roots {
+		if !below(existing.Path, root) {
+			roots = append(roots, existing)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].Path < roots[j].Path })
+	c.Roots = roots
+}
+
+// root returns the root indexed at path.
+func (c *Catalog) root(path string) (Root, bool) {
+	for _, r := range c.Roots {
+		if r.Path == path {
+			return r, true
+		}
+	}
+	return Root{}, false
+}
+
+// count returns how many files are below dir.
+func (c *Catalog) count(dir string) int {
+	n := 0
+	for path := range c.files {
+		if below(path, dir) {
+			n++
+		}
+	}
+	return n
+}
+
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+}
+
+// below reports whether path is dir or inside it.
+func below(path, dir string) bool {
+	sep := string(filepath.Separator)
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, sep)+sep)
+}
+
+func belowAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if below(path, dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package catalog
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+)
+
+func TestIndexKeepsEmptiedRoot(t *testing.T) {
+	fsys := vfs.NewMem()
+	for _, path := range []string{"/drive/a.jpg", "/drive/sub/b.txt"} {
+		if err := fsys.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := vfs.WriteFile(fsys, path, []byte(path), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := Open(fsys, "/catalog.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Index(context.Background(), "/drive", IndexOptions{FS: fsys}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.Entries()); n != 2 {
+		t.Fatalf("indexed %d files, want 2", n)
+	}
+
+	// The drive is unplugged, leaving its mountpoint empty.
+	for _, path := range []string{"/drive/sub/b.txt", "/drive/sub", "/drive/a.jpg"} {
+		if err := fsys.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := c.Index(context.Background(), "/drive", IndexOptions{FS: fsys})
+	if err == nil {
+		t.Error("indexing the emptied root succeeded")
+	}
+	if n := len(c.Entries()); n != 2 || len(result.Removed) != 0 {
+		t.Errorf("kept %d files and removed %v, want 2 kept", n, result.Removed)
+	}
+
+	result, err = c.Index(context.Background(), "/drive", IndexOptions{FS: fsys, Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.Entries()); n != 0 || len(result.Removed) != 2 {
+		t.Errorf("kept %d files and removed %v, want everything removed", n, result.Removed)
+	}
+}
+
+func TestIndexKeepsRootOnAnotherDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+	if err := os.Mkdir(root, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "a.jpg"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Open(nil, filepath.Join(dir, "catalog.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Index(context.Background(), root, IndexOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	device := c.Roots[0].Device
+	if device == 0 {
+		t.Skip("no device IDs on this platform")
+	}
+
+	// As if another file system was mounted at root since.
+	c.Roots[0].Device++
+	if _, err := c.Index(context.Background(), root, IndexOptions{}); err == nil {
+		t.Error("indexing a root on another device succeeded")
+	}
+	if _, err := c.Index(context.Background(), root, IndexOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if c.Roots[0].Device != device {
+		t.Errorf("forced index recorded device %d, want %d", c.Roots[0].Device, device)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package catalog
+
+import (
+	"os"
+	"syscall"
+)
+
+// deviceOf returns the ID of the device holding info, 0 when unknown.
+func deviceOf(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev)
+	}
+	return 0
+}
@@ -0,0 +1,233 @@
+package catalog
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/pkg/errors"
+)
+
+// Query selects catalog entries. It is written as terms separated by spaces,
+// every term must hold for an entry to match:
+//
+//	type:image camera:"NIKON D750" taken:2016 size>5MB -tag:blurry
+//
+// Terms are key:value, or key followed by >, >=, < or <= and a value for
+// size, taken and modified. The keys are:
+//
+//	type      category, "archive" or "other"
+//	ext       extension, with or without its dot
+//	name      file name
+//	path      full path
+//	camera    camera model
+//	tag       a tag of the file
+//	hash      md5, or a prefix of it
+//	size      size such as 512, 10KB or 1.5GB
+//	taken     capture date given as 2006, 2006-01 or 2006-01-02
+//	modified  modification date, like taken
+//
+// Name, path and camera match when they contain the value, or as a glob when
+// the value has wildcards. Text is compared ignoring case. A word without a
+// key matches the name, a leading - negates a term and values holding spaces
+// are quoted.
+type Query struct {
+	terms []term
+}
+
+// term is a single condition of a query.
+type term struct {
+	negate bool
+	match  func(e *Entry) bool
+}
+
+// ParseQuery reads a query, an empty one matches everything.
+func ParseQuery(s string) (*Query, error) {
+	words, err := split(s)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTerms(words)
+}
+
+// ParseTerms reads a query already split into its terms, such as the
+// arguments of a command the shell split, each word is a term of its own
+// whatever it holds.
+func ParseTerms(words []string) (*Query, error) {
+	q := &Query{}
+	for _, word := range words {
+		t, err := parseTerm(word)
+		if err != nil {
+			return nil, errors.Wrapf(err, "query term %s", word)
+		}
+		q.terms = append(q.terms, t)
+	}
+	return q, nil
+}
+
+// Match reports whether e satisfies every term of q.
+func (q *Query) Match(e *Entry) bool {
+	for _, t := range q.terms {
+		if t.match(e) == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// split breaks s into words on spaces outside of double quotes, dropping the
+// quotes.
+func split(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case unicode.IsSpace(r) && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote in query")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// operators are tried longest first, so >= isn't read as >.
+var operators = []string{">=", "<=", ":", ">", "<"}
+
+func parseTerm(word string) (term, error) {
+	t := term{}
+	if strings.HasPrefix(word, "-") && len(word) > 1 {
+		t.negate = true
+		word = word[1:]
+	}
+
+	key, operator, value := "", "", word
+	if i := strings.IndexAny(word, ":<>"); i > 0 {
+		for _, o := range operators {
+			if strings.HasPrefix(word[i:], o) {
+				key, operator, value = strings.ToLower(word[:i]), o, word[i+len(o):]
+				break
+			}
+		}
+	}
+	if key != "" && value == "" {
+		return t, errors.Errorf("%s needs a value", key)
+	}
+	if operator != "" && operator != ":" {
+		switch key {
+		case "size", "taken", "modified":
+		default:
+			return t, errors.Errorf("%s can't be compared with %s", key, operator)
+		}
+	}
+
+	var err error
+	switch key {
+	case "":
+		t.match = text(value, func(e *Entry) string { return filepath.Base(e.Path) })
+	case "name":
+		t.match = text(value, func(e *Entry) string { return filepath.Base(e.Path) })
+	case "path":
+		t.match = text(value, func(e *Entry) string { return e.Path })
+	case "camera":
+		t.match = text(value, func(e *Entry) string { return e.Camera })
+	case "type":
+		t.match = func(e *Entry) bool { return strings.EqualFold(e.Type, value) }
+	case "ext":
+		ext := strings.ToLower(value)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		t.match = func(e *Entry) bool { return strings.ToLower(filepath.Ext(e.Path)) == ext }
+	case "tag":
+		t.match = func(e *Entry) bool {
+			for _, tag := range e.Tags {
+				if strings.EqualFold(tag, value) {
+					return true
+				}
+			}
+			return false
+		}
+	case "hash", "md5":
+		prefix := strings.ToLower(value)
+		t.match = func(e *Entry) bool { return e.MD5 != "" && strings.HasPrefix(e.MD5, prefix) }
+	case "size":
+		var n int64
+		if n, err = op.ParseSize(value); err == nil {
+			t.match = compareSize(operator, n)
+		}
+	case "taken":
+		t.match, err = compareDate(operator, value, func(e *Entry) time.Time { return e.Taken })
+	case "modified":
+		t.match, err = compareDate(operator, value, func(e *Entry) time.Time { return e.ModTime })
+	default:
+		return t, errors.Errorf("unknown key: %s", key)
+	}
+	return t, err
+}
+
+// text matches the field when it contains value, or matches it as a glob.
+func text(value string, field func(e *Entry) string) func(e *Entry) bool {
+	value = strings.ToLower(value)
+	if strings.ContainsAny(value, "*?[") {
+		return func(e *Entry) bool {
+			ok, _ := filepath.Match(value, strings.ToLower(field(e)))
+			return ok
+		}
+	}
+	return func(e *Entry) bool { return strings.Contains(strings.ToLower(field(e)), value) }
+}
+
+func compareSize(operator string, n int64) func(e *Entry) bool {
+	switch operator {
+	case ">":
+		return func(e *Entry) bool { return e.Size > n }
+	case ">=":
+		return func(e *Entry) bool { return e.Size >= n }
+	case "<":
+		return func(e *Entry) bool { return e.Size < n }
+	case "<=":
+		return func(e *Entry) bool { return e.Size <= n }
+	}
+	return func(e *Entry) bool { return e.Size == n }
+}
+
+// compareDate compares against the period value covers, so taken>2016 is
+// 2017 onwards and taken<=2016 includes all of 2016.
+func compareDate(operator, value string, field func(e *Entry) time.Time) (func(e *Entry) bool, error) {
+	start, end, err := op.ParseDate(value)
+	if err != nil {
+		return nil, err
+	}
+	switch operator {
+	case ">":
+		return func(e *Entry) bool { return !field(e).Before(end) }, nil
+	case ">=":
+		return func(e *Entry) bool { return !field(e).Before(start) }, nil
+	case "<":
+		return func(e *Entry) bool { return field(e).Before(start) }, nil
+	case "<=":
+		return func(e *Entry) bool { return field(e).Before(end) }, nil
+	}
+	return func(e *Entry) bool {
+		t := field(e)
+		return !t.Before(start) && t.Before(end)
+	}, nil
+}
@@ -0,0 +1,36 @@
+package catalog
+
+import (
+	"testing"
+)
+
+func TestParseTermsKeepsEachWordWhole(t *testing.T) {
+	nikon := &Entry{Path: "/photos/a.jpg", Type: "image", Camera: "NIKON D750"}
+	canon := &Entry{Path: "/photos/b.jpg", Type: "image", Camera: "Canon EOS 5D"}
+
+	// What the shell passes for: find type:image camera:"NIKON D750"
+	q, err := ParseTerms([]string{"type:image", "camera:NIKON D750"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Match(nikon) || q.Match(canon) {
+		t.Error("camera with a space wasn't matched as a single term")
+	}
+
+	q, err = ParseTerms([]string{"-camera:NIKON D750"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Match(nikon) || !q.Match(canon) {
+		t.Error("negated camera with a space wasn't matched as a single term")
+	}
+
+	// A single string is still split on spaces outside of quotes.
+	q, err = ParseQuery(`type:image camera:"NIKON D750"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Match(nikon) || q.Match(canon) {
+		t.Error("quoted camera wasn't matched as a single term")
+	}
+}
@@ -0,0 +1,386 @@
+// Package config loads gorganize's configuration files. Files are TOML and
+// merged in order, later files overriding earlier ones:
+//
+//	# Top level keys are defaults for every command with such a flag.
+//	collision = "skip"
+//
+//	# Other tables hold the defaults of a command, subcommands nest.
+//	[flatten]
+//	category = ["image", "raw"]
+//	[archive.create]
+//	manifest = false
+//
+//	[categories]
+//	raw = [".cr2", ".nef", ".arw"]
+//
+//	[templates]
+//	by-day = "{date:2006-01-02}-{seq:03}.{ext}"
+//
+//	# Profiles are applied on top when selected with --profile.
+//	[profiles.camera-import]
+//	collision = "rename"
+//	[profiles.camera-import.flatten]
+//	archives = true
+package config
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// FileName is the name of the per-directory configuration file.
+const FileName = ".gorganize.toml"
+
+// Config is gorganize's configuration.
+type Config struct {
+	// Defaults are flag values for every command that has the flag.
+	Defaults map[string]interface{}
+	// Commands are flag values per command, keyed by the command path without
+	// the program name, such as "flatten" or "archive create".
+	Commands map[string]map[string]interface{}
+	// Categories are extension categories on top of the built in ones.
+	Categories map[string][]string
+	// Templates are named rename templates.
+	Templates map[string]string
+	// Profiles are configs applied on top of this one by name.
+	Profiles map[string]*Config
+	// Sources are the files loaded, in the order they were merged.
+	Sources []string
+}
+
+// New returns an empty Config.
+func New() *Config {
+	return &Config{
+		Defaults:   make(map[string]interface{}),
+		Commands:   make(map[string]map[string]interface{}),
+		Categories: make(map[string][]string),
+		Templates:  make(map[string]string),
+		Profiles:   make(map[string]*Config),
+	}
+}
+
+// Paths lists the files Load looks at, in merge order: the user's file in the
+// XDG config dir, then every .gorganize.toml from the root of the filesystem
+// down to dir, so the nearest one wins.
+func Paths(dir string) []string {
+	var paths []string
+	if home := userConfigDir(); home != "" {
+		paths = append(paths, filepath.Join(home, "gorganize", "config.toml"))
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return paths
+	}
+	var local []string
+	for {
+		local = append(local, filepath.Join(dir, FileName))
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	for i := len(local) - 1; i >= 0; i-- {
+		paths = append(paths, local[i])
+	}
+	return paths
+}
+
+// userConfigDir follows the XDG base directory spec, also on macOS where
+// dotfile users expect it.
+func userConfigDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".config")
+	}
+	return ""
+}
+
+// Load merges the files at paths that exist, in order.
+func Load(fsys vfs.FS, paths []string) (*Config, error) {
+	c := New()
+	for _, path := range paths {
+		f, err := fsys.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "config.Load couldn't open file")
+		}
+		loaded, err := Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "config %s", path)
+		}
+		c.Merge(loaded)
+		c.Sources = append(c.Sources, path)
+	}
+	return c, nil
+}
+
+// Parse reads a single configuration file.
+func Parse(r io.Reader) (*Config, error) {
+	var doc map[string]interface{}
+	if _, err := toml.DecodeReader(r, &doc); err != nil {
+		return nil, err
+	}
+	return fromDoc(doc, true)
+}
+
+func fromDoc(doc map[string]interface{}, withProfiles bool) (*Config, error) {
+	c := New()
+	for key, value := range doc {
+		var err error
+		switch key {
+		case "categories":
+			err = c.parseCategories(value)
+		case "templates":
+			err = c.parseTemplates(value)
+		case "profiles":
+			if !withProfiles {
+				return nil, errors.New("profiles can't be nested")
+			}
+			err = c.parseProfiles(value)
+		default:
+			if table, ok := value.(map[string]interface{}); ok {
+				err = c.parseCommand(key, table)
+			} else {
+				c.Defaults[key] = value
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Config) parseCategories(value interface{}) error {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("categories must be a table")
+	}
+	for name, v := range table {
+		exts, ok := stringList(v)
+		if !ok {
+			return errors.Errorf("category %s must be a list of extensions", name)
+		}
+		c.Categories[name] = exts
+	}
+	return nil
+}
+
+func (c *Config) parseTemplates(value interface{}) error {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("templates must be a table")
+	}
+	for name, v := range table {
+		s, ok := v.(string)
+		if !ok {
+			return errors.Errorf("template %s must be a string", name)
+		}
+		c.Templates[name] = s
+	}
+	return nil
+}
+
+func (c *Config) parseProfiles(value interface{}) error {
+	table, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("profiles must be a table")
+	}
+	for name, v := range table {
+		doc, ok := v.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("profile %s must be a table", name)
+		}
+		profile, err := fromDoc(doc, false)
+		if err != nil {
+			return errors.Wrapf(err, "profile %s", name)
+		}
+		c.Profiles[name] = profile
+	}
+	return nil
+}
+
+// parseCommand reads the flags of command, tables within are subcommands.
+func (c *Config) parseCommand(command string, table map[string]interface{}) error {
+	flags := c.Commands[command]
+	if flags == nil {
+		flags = make(map[string]interface{})
+		c.Commands[command] = flags
+	}
+	for key, value := range table {
+		if sub, ok := value.(map[string]interface{}); ok {
+			if err := c.parseCommand(command+" "+key, sub); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := value.([]map[string]interface{}); ok {
+			return errors.Errorf("%s.%s can't be an array of tables", command, key)
+		}
+		flags[key] = value
+	}
+	return nil
+}
+
+func stringList(v interface{}) ([]string, bool) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		list = append(list, s)
+	}
+	return list, true
+}
+
+// Merge applies o on top of c. Values are replaced key by key, lists are not
+// concatenated.
+func (c *Config) Merge(o *Config) {
+	for k, v := range o.Defaults {
+		c.Defaults[k] = v
+	}
+	for command, flags := range o.Commands {
+		if c.Commands[command] == nil {
+			c.Commands[command] = make(map[string]interface{})
+		}
+		for k, v := range flags {
+			c.Commands[command][k] = v
+		}
+	}
+	for k, v := range o.Categories {
+		c.Categories[k] = v
+	}
+	for k, v := range o.Templates {
+		c.Templates[k] = v
+	}
+	for name, profile := range o.Profiles {
+		if existing, ok := c.Profiles[name]; ok {
+			existing.Merge(profile)
+			continue
+		}
+		merged := New()
+		merged.Merge(profile)
+		c.Profiles[name] = merged
+	}
+}
+
+// WithProfile returns c with the named profile applied on top.
+func (c *Config) WithProfile(name string) (*Config, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, errors.Errorf("unknown profile: %s, expected one of: %s", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	merged := New()
+	merged.Merge(c)
+	merged.Merge(profile)
+	merged.Sources = c.Sources
+	return merged, nil
+}
+
+// ProfileNames lists the profiles sorted by name.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Flags returns the flag values for command: the defaults overridden by the
+// command's own table.
+func (c *Config) Flags(command string) map[string]interface{} {
+	flags := make(map[string]interface{})
+	for k, v := range c.Defaults {
+		flags[k] = v
+	}
+	for k, v := range c.Commands[command] {
+		flags[k] = v
+	}
+	return flags
+}
+
+// Doc turns c back into the TOML document it would be read from.
+func (c *Config) Doc() map[string]interface{} {
+	doc := make(map[string]interface{})
+	for k, v := range c.Defaults {
+		doc[k] = v
+	}
+	for command, flags := range c.Commands {
+		table := doc
+		for _, part := range strings.Fields(command) {
+			sub, ok := table[part].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				table[part] = sub
+			}
+			table = sub
+		}
+		for k, v := range flags {
+			table[k] = v
+		}
+	}
+	if len(c.Categories) > 0 {
+		categories := make(map[string]interface{})
+		for k, v := range c.Categories {
+			categories[k] = v
+		}
+		doc["categories"] = categories
+	}
+	if len(c.Templates) > 0 {
+		templates := make(map[string]interface{})
+		for k, v := range c.Templates {
+			templates[k] = v
+		}
+		doc["templates"] = templates
+	}
+	if len(c.Profiles) > 0 {
+		profiles := make(map[string]interface{})
+		for name, profile := range c.Profiles {
+			profiles[name] = profile.Doc()
+		}
+		doc["profiles"] = profiles
+	}
+	return doc
+}
+
+// FlagValue renders a configured value the way it would be typed on the
+// command line, lists become comma separated.
+func FlagValue(v interface{}) string {
+	items, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprint(v)
+	}
+
+	record := make([]string, len(items))
+	for i, item := range items {
+		record[i] = fmt.Sprint(item)
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(record)
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,34 @@
+// Package logging is how the file_management packages report what they are
+// doing. Programs embedding them pass their own Logger in the options of each
+// operation, or replace Default.
+package logging
+
+// Logger is satisfied by *logrus.Logger and *logrus.Entry among others.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Discard drops every message.
+var Discard Logger = discard{}
+
+// Default is used by operations given no Logger, it discards everything until
+// a program sets it.
+var Default = Discard
+
+// Or returns l, or Default when l is nil.
+func Or(l Logger) Logger {
+	if l == nil {
+		return Default
+	}
+	return l
+}
+
+type discard struct{}
+
+func (discard) Debugf(format string, args ...interface{}) {}
+func (discard) Infof(format string, args ...interface{})  {}
+func (discard) Warnf(format string, args ...interface{})  {}
+func (discard) Errorf(format string, args ...interface{}) {}
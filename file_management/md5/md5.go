@@ -1,45 +1,70 @@
 package md5
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"io"
-	"os"
 	"runtime"
 	"sync"
 
+	"github.com/deckarep/gorganize/file_management/progress"
+	"github.com/deckarep/gorganize/file_management/vfs"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
 // Sum computes the MD5 for a given file and returns the hex encoded string.
-func Sum(file string) (string, error) {
-	existFile, err := os.Open(file)
+// It stops with ctx's error once ctx is done.
+func Sum(ctx context.Context, fsys vfs.FS, file string) (string, error) {
+	return sum(ctx, fsys, file, nil)
+}
+
+// sum is Sum counting the bytes it reads against t.
+func sum(ctx context.Context, fsys vfs.FS, file string, t *progress.Tracker) (string, error) {
+	existFile, err := fsys.Open(file)
 	if err != nil {
 		return "", errors.Wrap(err, "md5.Sum couldn't open file")
 	}
 	defer existFile.Close()
 
 	h := md5.New()
-	if _, err := io.Copy(h, existFile); err != nil {
+	if _, err := io.Copy(h, t.Reader(&contextReader{ctx: ctx, r: existFile})); err != nil {
 		return "", errors.Wrap(err, "md5.Sum couldn't io.Copy file")
 	}
 
 	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
+// contextReader reads from r until ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
 // SumValue is the tuple of Name/Hash results returned from the PSum operation.
+// Err is set instead of Hash when the file couldn't be hashed.
 type SumValue struct {
 	Name string
 	Hash string
+	Err  error
 }
 
 // PSum executes MD5 sum in parallel based on a worker count.
 // If workers is 0, runtime.NumCPU() is utilized for the worker count.
-func PSum(workers int) (chan<- string, <-chan SumValue) {
+// Every name sent yields exactly one SumValue, once ctx is done the remaining
+// names are answered with its error without being hashed.
+// Hashing is reported to t, which may be nil. PSum doesn't know how many names
+// are coming so the caller reports what it discovers.
+func PSum(ctx context.Context, fsys vfs.FS, workers int, t *progress.Tracker) (chan<- string, <-chan SumValue) {
 	if workers == 0 {
 		workers = runtime.NumCPU()
-		logrus.Debugf("Running PSum with a max parallelism of %d", workers)
 	}
 
 	incomingChan := make(chan string, workers)
@@ -52,14 +77,22 @@ func PSum(workers int) (chan<- string, <-chan SumValue) {
 		go func() {
 			defer wg.Done()
 			for item := range incomingChan {
-				result, err := Sum(item)
-				if err != nil {
-					logrus.Error("Error calculating md5 sum: ", err.Error())
+				if err := ctx.Err(); err != nil {
+					t.Failed(0)
+					outgoingChan <- SumValue{Name: item, Err: err}
 					continue
 				}
+				t.Start(item)
+				result, err := sum(ctx, fsys, item, t)
+				if err != nil {
+					t.Failed(0)
+				} else {
+					t.Processed(0)
+				}
 				outgoingChan <- SumValue{
 					Name: item,
 					Hash: result,
+					Err:  err,
 				}
 			}
 		}()
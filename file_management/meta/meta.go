@@ -0,0 +1,207 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// Info is the subset of embedded file metadata that gorganize understands.
+type Info struct {
+	// Taken is when the media was captured. It falls back to the file's
+	// modification time when no capture date is embedded.
+	Taken time.Time
+	// Camera is the camera model as recorded by the device, if any.
+	Camera string
+}
+
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+
+	exifDateLayout = "2006:01:02 15:04:05"
+)
+
+// Read extracts metadata from a JPEG or TIFF based (tiff, nef) file. Files
+// without EXIF data are not an error, the returned Info simply carries the
+// modification time.
+func Read(fsys vfs.FS, path string) (Info, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "meta.Read couldn't open file")
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return Info{}, errors.Wrap(err, "meta.Read couldn't stat file")
+	}
+
+	info, err := ReadFrom(f, stat.Size())
+	if err != nil {
+		return Info{}, err
+	}
+	if info.Taken.IsZero() {
+		info.Taken = stat.ModTime()
+	}
+	return info, nil
+}
+
+// ReadFrom extracts metadata from r which holds size bytes. Unlike Read it
+// has no file to fall back on, so Taken is zero when no date is embedded.
+func ReadFrom(r io.ReaderAt, size int64) (Info, error) {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		// Too small to carry any metadata.
+		return Info{}, nil
+	}
+
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		tiff, err := jpegExif(io.NewSectionReader(r, 0, size))
+		if err != nil || tiff == nil {
+			return Info{}, err
+		}
+		return parseTIFF(bytes.NewReader(tiff)), nil
+	case string(magic[:]) == "II*\x00" || string(magic[:]) == "MM\x00*":
+		return parseTIFF(r), nil
+	}
+	return Info{}, nil
+}
+
+// jpegExif walks the JPEG markers and returns the TIFF payload of the Exif
+// APP1 segment or nil when there isn't one.
+func jpegExif(r io.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return nil, nil
+	}
+
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return nil, nil
+		}
+		if marker[0] != 0xFF {
+			return nil, nil
+		}
+		// Start of scan: image data follows, no more metadata segments.
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return nil, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil, nil
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, errors.Wrap(err, "meta couldn't read jpeg segment")
+		}
+		if marker[1] == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value [4]byte
+}
+
+func parseTIFF(r io.ReaderAt) Info {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return Info{}
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if header[0] == 'M' {
+		order = binary.BigEndian
+	}
+
+	var info Info
+	var dateTime, original string
+
+	ifd0 := readIFD(r, order, int64(order.Uint32(header[4:])))
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagModel:
+			info.Camera = readASCII(r, order, e)
+		case tagMake:
+			if info.Camera == "" {
+				info.Camera = readASCII(r, order, e)
+			}
+		case tagDateTime:
+			dateTime = readASCII(r, order, e)
+		case tagExifIFD:
+			for _, sub := range readIFD(r, order, int64(order.Uint32(e.value[:]))) {
+				if sub.tag == tagDateTimeOriginal {
+					original = readASCII(r, order, sub)
+				}
+			}
+		}
+	}
+
+	for _, candidate := range []string{original, dateTime} {
+		if t, err := time.ParseInLocation(exifDateLayout, candidate, time.Local); err == nil {
+			info.Taken = t
+			break
+		}
+	}
+	return info
+}
+
+func readIFD(r io.ReaderAt, order binary.ByteOrder, offset int64) []ifdEntry {
+	var countBuf [2]byte
+	if offset <= 0 {
+		return nil
+	}
+	if _, err := r.ReadAt(countBuf[:], offset); err != nil {
+		return nil
+	}
+
+	count := int(order.Uint16(countBuf[:]))
+	raw := make([]byte, count*12)
+	if _, err := r.ReadAt(raw, offset+2); err != nil {
+		return nil
+	}
+
+	entries := make([]ifdEntry, count)
+	for i := range entries {
+		b := raw[i*12:]
+		entries[i].tag = order.Uint16(b[0:])
+		entries[i].typ = order.Uint16(b[2:])
+		entries[i].count = order.Uint32(b[4:])
+		copy(entries[i].value[:], b[8:12])
+	}
+	return entries
+}
+
+func readASCII(r io.ReaderAt, order binary.ByteOrder, e ifdEntry) string {
+	// Type 2 is ASCII, anything else is not a string we care about.
+	if e.typ != 2 || e.count == 0 || e.count > 1024 {
+		return ""
+	}
+
+	var b []byte
+	if e.count <= 4 {
+		b = e.value[:e.count]
+	} else {
+		b = make([]byte, e.count)
+		if _, err := r.ReadAt(b, int64(order.Uint32(e.value[:]))); err != nil {
+			return ""
+		}
+	}
+	return strings.TrimSpace(strings.TrimRight(string(b), "\x00"))
+}
@@ -0,0 +1,159 @@
+package op
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/deckarep/gorganize/file_management/archive"
+	"github.com/deckarep/gorganize/file_management/logging"
+	md5sum "github.com/deckarep/gorganize/file_management/md5"
+	"github.com/deckarep/gorganize/file_management/progress"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// flattenArchive copies the entries of the archive at archivePath matching the
+// extensions of opts straight into destFolder, adding their outcomes to result.
+// The archive counts as a single file for progress, t only follows along
+// its entries. An archive exceeding opts.Limits is abandoned at that point.
+func flattenArchive(ctx context.Context, archivePath, destFolder string, opts FlattenOptions, result *Result, t *progress.Tracker) {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	charset := opts.Charset
+	if charset.Name == "" {
+		charset = archive.DefaultCharset
+	}
+	fail := func(err error) {
+		log.Errorf("Failed to read archive: %s with err: %s", archivePath, err)
+		result.add(FileResult{Src: archivePath, Action: Failed, Err: err})
+	}
+
+	info, err := fsys.Stat(archivePath)
+	if err != nil {
+		fail(err)
+		return
+	}
+	reader, _, err := archive.Open(fsys, archivePath)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer reader.Close()
+	budget := archive.NewBudget(opts.Limits, info.Size())
+
+	for ctx.Err() == nil {
+		hdr, err := reader.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+		if err := budget.Entry(); err != nil {
+			fail(err)
+			return
+		}
+		if hdr.Type != archive.TypeFile {
+			continue
+		}
+
+		entryName := hdr.Name
+		if hdr.NonUTF8 {
+			entryName = charset.Decode(entryName)
+		}
+
+		// Entry names are slash separated whatever the platform, only the
+		// base name survives flattening so traversal in the name is moot.
+		name := strings.ToLower(path.Base(strings.Replace(entryName, "\\", "/", -1)))
+		if name == "." || name == ".." || name == "/" || !opts.matches(name) {
+			continue
+		}
+
+		if err := budget.Admit(entryName, hdr.CompressedSize, hdr.Size); err != nil {
+			fail(err)
+			return
+		}
+
+		src := archivePath + "!" + entryName
+		destFile := filepath.Join(destFolder, name)
+		t.Start(src)
+		fr, err := CopyReader(ctx, budget.Reader(reader), src, destFile, Options{Logger: opts.Logger, FS: opts.FS, Collision: opts.Collision})
+		if errors.Cause(err) == archive.ErrLimitExceeded {
+			// A hostile archive, the rest of it isn't worth reading.
+			fail(err)
+			return
+		}
+		if err != nil {
+			log.Errorf("Failed to copy file: %s to dest %s with err: %s", src, destFile, err.Error())
+		}
+		result.add(fr)
+	}
+}
+
+// CopyReader copies the stream r, labelled src in logs, to dst following the
+// same collision rules as CopyFile. The stream is hashed while it is written
+// to a temp file next to dst, so it is read exactly once.
+func CopyReader(ctx context.Context, r io.Reader, src, dst string, opts Options) (FileResult, error) {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	fr := FileResult{Src: src, Dst: dst}
+
+	tmpName := dst + ".gorganize-tmp"
+	tmp, err := fsys.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fr.fail(errors.Wrap(err, "couldn't create temp file during copyReader"))
+	}
+	defer fsys.Remove(tmpName)
+
+	h := md5.New()
+	fr.Bytes, err = io.Copy(io.MultiWriter(tmp, h), &contextReader{ctx: ctx, r: r})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fr.fail(errors.Wrap(err, "couldn't io.Copy during copyReader"))
+	}
+	sourceHash := hex.EncodeToString(h.Sum(nil))
+
+	target, action := dst, Copied
+	if _, err := fsys.Stat(dst); err == nil {
+		destHash, err := md5sum.Sum(ctx, fsys, dst)
+		if err != nil {
+			return fr.fail(errors.Wrap(err, "couldn't md5Sum destHash"))
+		}
+		if destHash == sourceHash {
+			log.Infof("Exact match found:%s, skipping...", filepath.Base(dst))
+			fr.Action = Identical
+			return fr, nil
+		}
+		name, ext := filenameAndExt(dst)
+		target, action, _ = collide(dst, fmt.Sprintf("%s-%s%s", name, destHash[0:5], ext), opts.Collision)
+		if action == Existing {
+			log.Infof("Different file found:%s, keeping it and skipping...", filepath.Base(dst))
+			fr.Action = Existing
+			return fr, nil
+		}
+	}
+
+	if err := fsys.Rename(tmpName, target); err != nil {
+		return fr.fail(errors.Wrap(err, "couldn't move temp file into place"))
+	}
+
+	fr.Dst, fr.Action = target, action
+	switch action {
+	case Renamed:
+		log.Infof("Similar file found:%s, copied as %s", dst, filepath.Base(target))
+	case Overwritten:
+		log.Infof("Different file found:%s, overwriting it", dst)
+	}
+	log.Infof("Copied file: %s -> %s", src, target)
+	return fr, nil
+}
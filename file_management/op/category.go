@@ -0,0 +1,109 @@
+package op
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/pkg/errors"
+)
+
+var (
+	// imageSet is all image file types.
+	imageSet = mapset.NewThreadUnsafeSetFromSlice([]interface{}{
+		".psd", ".pdf", ".png", ".gif", ".jpg", ".jpeg", ".tiff", ".nef", ".raw"})
+
+	// videoSet is video file types.
+	videoSet = mapset.NewThreadUnsafeSetFromSlice([]interface{}{
+		".mov", ".avi", ".mp4", ".m4v", ".mkv"})
+
+	// categories maps a category name to the extensions it covers, "all" is
+	// the entire kitchen sink.
+	categories = map[string]mapset.Set{
+		"image": imageSet,
+		"video": videoSet,
+		"all":   imageSet.Union(videoSet),
+	}
+)
+
+// CategoryNames lists the known category names.
+func CategoryNames() []string {
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CategoryExtensions returns the lowercase extensions, dot included, of the
+// named category.
+func CategoryExtensions(name string) (mapset.Set, bool) {
+	set, ok := categories[strings.ToLower(name)]
+	return set, ok
+}
+
+// AddCategory defines or redefines the named category, for categories coming
+// from configuration. Extensions may be given with or without their dot, they
+// are also added to "all". The built in categories can't be redefined.
+func AddCategory(name string, extensions []string) error {
+	name = strings.ToLower(name)
+	switch name {
+	case "image", "video", "all":
+		return errors.Errorf("category %s is built in", name)
+	}
+
+	set := mapset.NewThreadUnsafeSet()
+	for _, ext := range extensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		set.Add(ext)
+	}
+	categories[name] = set
+	categories["all"] = categories["all"].Union(set)
+	return nil
+}
+
+// Selection matches file names against category names and globs, e.g.
+// "image" or "*.mov". An empty Selection matches everything.
+type Selection struct {
+	extensions mapset.Set
+	globs      Filter
+}
+
+// ParseSelection turns a list of category names and globs into a Selection.
+func ParseSelection(items []string) (*Selection, error) {
+	s := &Selection{extensions: mapset.NewThreadUnsafeSet()}
+	for _, item := range items {
+		if set, ok := CategoryExtensions(item); ok {
+			s.extensions = s.extensions.Union(set)
+			continue
+		}
+		s.globs.Include = append(s.globs.Include, item)
+	}
+	if err := s.globs.Validate(); err != nil {
+		return nil, errors.Wrap(err, "not a category or a valid glob")
+	}
+	return s, nil
+}
+
+// Empty reports whether the selection lets everything through.
+func (s *Selection) Empty() bool {
+	return s == nil || ((s.extensions == nil || s.extensions.Cardinality() == 0) && len(s.globs.Include) == 0)
+}
+
+// Match reports whether the file at path is selected. Only the base name is
+// considered.
+func (s *Selection) Match(path string) bool {
+	if s.Empty() {
+		return true
+	}
+	name := filepath.Base(path)
+	if s.extensions != nil && s.extensions.Contains(strings.ToLower(filepath.Ext(name))) {
+		return true
+	}
+	return len(s.globs.Include) > 0 && matchAny(s.globs.Include, name)
+}
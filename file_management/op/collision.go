@@ -0,0 +1,61 @@
+package op
+
+import (
+	"context"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// Collision decides what happens when a different file already has the
+// destination name. Identical content is always skipped.
+type Collision string
+
+const (
+	// CollisionRename writes the file next to the existing one with a hash
+	// suffix, the default.
+	CollisionRename Collision = "rename"
+	// CollisionSkip keeps the existing file and leaves the new one be.
+	CollisionSkip Collision = "skip"
+	// CollisionOverwrite replaces the existing file.
+	CollisionOverwrite Collision = "overwrite"
+)
+
+// ParseCollision validates a collision policy name, "" is CollisionRename.
+func ParseCollision(name string) (Collision, error) {
+	switch c := Collision(name); c {
+	case "":
+		return CollisionRename, nil
+	case CollisionRename, CollisionSkip, CollisionOverwrite:
+		return c, nil
+	}
+	return "", errors.Errorf("unknown collision policy: %s, expected rename, skip or overwrite", name)
+}
+
+// Resolve decides where src goes when asked to go to dst under policy. The
+// action is Copied when dst is free, Identical or Existing when nothing should
+// be written, and otherwise Renamed or Overwritten.
+func Resolve(ctx context.Context, fsys vfs.FS, src, dst string, policy Collision) (string, Action, error) {
+	target, identical, err := ResolveCollision(ctx, fsys, src, dst)
+	switch {
+	case err != nil:
+		return "", Failed, err
+	case identical:
+		return dst, Identical, nil
+	case target == dst:
+		return dst, Copied, nil
+	}
+	return collide(dst, target, policy)
+}
+
+// collide applies policy to a dst holding different content, renamed being
+// the name CollisionRename would use.
+func collide(dst, renamed string, policy Collision) (string, Action, error) {
+	switch policy {
+	case CollisionSkip:
+		return dst, Existing, nil
+	case CollisionOverwrite:
+		return dst, Overwritten, nil
+	}
+	return renamed, Renamed, nil
+}
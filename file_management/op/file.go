@@ -1,64 +1,222 @@
 package op
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	mapset "github.com/deckarep/golang-set"
+	"github.com/deckarep/gorganize/file_management/archive"
+	"github.com/deckarep/gorganize/file_management/logging"
 	md5 "github.com/deckarep/gorganize/file_management/md5"
+	"github.com/deckarep/gorganize/file_management/progress"
+	"github.com/deckarep/gorganize/file_management/vfs"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
+// FlattenOptions controls FlattenFolderByExtension.
+type FlattenOptions struct {
+	// Extensions are the lowercase extensions, dot included, to flatten. nil
+	// flattens every file.
+	Extensions mapset.Set
+	// Archives treats archives found along the way as folders, their matching
+	// entries are copied straight out of the archive. Only files named like
+	// archives are looked into, see archive.HasExt.
+	Archives bool
+	// Limits caps what each archive may expand to, an archive exceeding them
+	// is abandoned. The zero value disables every check.
+	Limits archive.Limits
+	// Charset decodes archive entry names that aren't UTF-8, it defaults to
+	// cp437.
+	Charset archive.Charset
+	Logger  logging.Logger
+	FS      vfs.FS
+	// Progress receives progress events, nil reports nothing.
+	Progress progress.Reporter
+	// Collision is what to do when a different file already has the
+	// destination name, it defaults to CollisionRename.
+	Collision Collision
+}
+
 // FlattenFolderByExtension will take a source folder, find all files by the extensions
-// argument and flatten the found files into a single destination folder.
-func FlattenFolderByExtension(sourceFolder, destFolder string, extensions mapset.Set) {
+// option and flatten the found files into a single destination folder. A file that
+// fails to copy is recorded in the result and the walk carries on, the returned
+// error is reserved for failing to walk sourceFolder at all or ctx being done.
+func FlattenFolderByExtension(ctx context.Context, sourceFolder, destFolder string, opts FlattenOptions) (*Result, error) {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	result := &Result{}
+	defer result.since(time.Now())
+	tracker := progress.NewTracker("flatten", opts.Progress)
+	defer tracker.Done()
+
 	// 1.) Ensure destination directory
-	createDirIfNotExists(destFolder)
+	if err := createDirIfNotExists(fsys, destFolder); err != nil {
+		return result, err
+	}
 
-	// 2.) Begin walking filesystem.
-	err := filepath.Walk(
+	// 2.) Walk the filesystem first so the total is known up front.
+	var found []flattenItem
+	err := vfs.Walk(
+		fsys,
 		sourceFolder,
 		func(path string, info os.FileInfo, err error) error {
-			if !info.IsDir() {
-				extensions.Each(func(item interface{}) bool {
-					ext := item.(string)
-					pathLowerCase := strings.ToLower(path)
-					if strings.ToLower(filepath.Ext(pathLowerCase)) == ext {
-						sourceFile := pathLowerCase
-						destFile := filepath.Join(destFolder, filepath.Base(pathLowerCase))
-
-						err := CopyFile(sourceFile, destFile)
-						if err != nil {
-							logrus.Errorf("Failed to copy file: %s to dest %s with err: %s", sourceFile, destFile, err.Error())
-						}
-					}
-					return false
-				})
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
 			}
+
+			item := flattenItem{path: path, size: info.Size()}
+			if !opts.matches(path) {
+				if !opts.Archives || !archive.HasExt(path) {
+					return nil
+				}
+				format, err := archive.Detect(fsys, path)
+				if err != nil || format == archive.Unknown {
+					return nil
+				}
+				item.archive = true
+			}
+			found = append(found, item)
+			tracker.Discovered(1, item.size)
 			return nil
 		})
-
 	if err != nil {
-		logrus.Fatal("Couldn't walk the root folder with err: ", err.Error())
+		return result, errors.Wrapf(err, "couldn't walk the root folder: %s", sourceFolder)
+	}
+
+	// 3.) Copy what was found.
+	copyOpts := Options{Logger: opts.Logger, FS: opts.FS, Collision: opts.Collision}
+	for _, item := range found {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if item.archive {
+			flattenArchive(ctx, item.path, destFolder, opts, result, tracker)
+			tracker.Processed(item.size)
+			continue
+		}
+
+		destFile := filepath.Join(destFolder, strings.ToLower(filepath.Base(item.path)))
+		fr, err := copyFile(ctx, item.path, destFile, copyOpts, tracker)
+		if err != nil {
+			log.Errorf("Failed to copy file: %s to dest %s with err: %s", item.path, destFile, err.Error())
+		}
+		result.add(fr)
+	}
+	return result, nil
+}
+
+// matches reports whether the file at path has one of the extensions.
+func (opts FlattenOptions) matches(path string) bool {
+	return opts.Extensions == nil || opts.Extensions.Contains(strings.ToLower(filepath.Ext(path)))
+}
+
+// flattenItem is a file found by FlattenFolderByExtension, either a match or
+// an archive to look into.
+type flattenItem struct {
+	path    string
+	size    int64
+	archive bool
+}
+
+// CopyFile the src file to dst. When dst already holds the same content nothing
+// is written, when it holds different content opts.Collision decides, by
+// default src is copied next to it with a hash suffix. File attributes are not
+// copied.
+func CopyFile(ctx context.Context, src, dst string, opts Options) (FileResult, error) {
+	tracker := progress.NewTracker("copy", opts.Progress)
+	defer tracker.Done()
+	if info, err := vfs.Or(opts.FS).Stat(src); err == nil {
+		tracker.Discovered(1, info.Size())
 	}
+	return copyFile(ctx, src, dst, opts, tracker)
 }
 
-// CopyFile the src file to dst. Any existing file will be overwritten and will not
-// copy file attributes.
-func CopyFile(src, dst string) error {
-	in, err := os.Open(src)
+// copyFile is CopyFile reporting to t, so callers copying many files can
+// report them as one operation.
+func copyFile(ctx context.Context, src, dst string, opts Options, t *progress.Tracker) (fr FileResult, err error) {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	fr = FileResult{Src: src, Dst: dst}
+	defer func() { report(t, fr) }()
+	if err := ctx.Err(); err != nil {
+		return fr.fail(err)
+	}
+	t.Start(src)
+
+	in, err := fsys.Open(src)
 	if err != nil {
-		return errors.Wrap(err, "couldn't open src file during copyFile")
+		return fr.fail(errors.Wrap(err, "couldn't open src file during copyFile"))
 	}
 	defer in.Close()
 
-	if _, err := os.Stat(dst); os.IsNotExist(err) {
-		return writeDestFile(in, src, dst)
+	info, err := in.Stat()
+	if err != nil {
+		return fr.fail(errors.Wrap(err, "couldn't stat src file during copyFile"))
+	}
+	fr.Bytes = info.Size()
+
+	target, action, err := Resolve(ctx, fsys, src, dst, opts.Collision)
+	if err != nil {
+		return fr.fail(err)
+	}
+	switch action {
+	case Identical:
+		log.Infof("Exact match found:%s, skipping...", filepath.Base(dst))
+		fr.Action = Identical
+		return fr, nil
+	case Existing:
+		log.Infof("Different file found:%s, keeping it and skipping...", filepath.Base(dst))
+		fr.Action = Existing
+		return fr, nil
+	}
+
+	if err := writeDestFile(ctx, fsys, t.Reader(in), target); err != nil {
+		return fr.fail(err)
+	}
+
+	fr.Dst, fr.Action = target, action
+	switch action {
+	case Renamed:
+		log.Infof("Similar file found:%s, copied as %s", dst, filepath.Base(target))
+	case Overwritten:
+		log.Infof("Different file found:%s, overwriting it", dst)
+	}
+	log.Infof("Copied file: %s -> %s", src, target)
+	return fr, nil
+}
+
+// report counts the outcome of a copy against t. Bytes written were counted
+// as they were read.
+func report(t *progress.Tracker, fr FileResult) {
+	switch fr.Action {
+	case Failed:
+		t.Failed(0)
+	case Identical, Existing:
+		t.Skipped(fr.Bytes)
+	default:
+		t.Processed(0)
+	}
+}
+
+// ResolveCollision decides where src should land when asked to go to dst. When
+// dst is free it is returned as is. When dst holds identical content, identical
+// is true and nothing should be written. Otherwise a sibling name suffixed with
+// part of the existing file's hash is returned.
+func ResolveCollision(ctx context.Context, fsys vfs.FS, src, dst string) (target string, identical bool, err error) {
+	if _, err := fsys.Stat(dst); os.IsNotExist(err) {
+		return dst, false, nil
 	}
 
 	var wg sync.WaitGroup
@@ -69,8 +227,8 @@ func CopyFile(src, dst string) error {
 
 	go func() {
 		defer wg.Done()
-		hash, md5SumError := md5.Sum(src)
-		if err != nil {
+		hash, md5SumError := md5.Sum(ctx, fsys, src)
+		if md5SumError != nil {
 			sourceHashError = errors.Wrap(md5SumError, "couldn't md5sum sourceHash")
 		}
 		sourceHash = hash
@@ -81,8 +239,8 @@ func CopyFile(src, dst string) error {
 
 	go func() {
 		defer wg.Done()
-		hash, md5SumError := md5.Sum(dst)
-		if err != nil {
+		hash, md5SumError := md5.Sum(ctx, fsys, dst)
+		if md5SumError != nil {
 			destHashError = errors.Wrap(md5SumError, "couldn't md5Sum destHash")
 		}
 		destHash = hash
@@ -91,36 +249,41 @@ func CopyFile(src, dst string) error {
 	wg.Wait()
 
 	if sourceHashError != nil {
-		return sourceHashError
+		return "", false, sourceHashError
 	}
 
 	if destHashError != nil {
-		return destHashError
+		return "", false, destHashError
 	}
 
-	if sourceHash != destHash {
-		logrus.Printf("Similar file found:%s, diff hash:%s", dst, destHash)
-		name, ext := filenameAndExt(dst)
-		return writeDestFile(in, src, fmt.Sprintf("%s-%s%s", name, destHash[0:5], ext))
+	if sourceHash == destHash {
+		return dst, true, nil
 	}
 
-	logrus.Printf("Exact match found:%s, skipping...", filepath.Base(dst))
-
-	return nil
+	name, ext := filenameAndExt(dst)
+	return fmt.Sprintf("%s-%s%s", name, destHash[0:5], ext), false, nil
 }
 
-func writeDestFile(srcReader io.Reader, src, dst string) error {
-	out, err := os.Create(dst)
+// writeDestFile writes srcReader to a temp file next to dst and moves it into
+// place, so dst is never left half written. When ctx is done the copy stops
+// and the temp file is removed.
+func writeDestFile(ctx context.Context, fsys vfs.FS, srcReader io.Reader, dst string) error {
+	tmp := dst + ".gorganize-tmp"
+	out, err := vfs.Create(fsys, tmp)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, srcReader)
+	_, err = io.Copy(out, &contextReader{ctx: ctx, r: srcReader})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fsys.Rename(tmp, dst)
+	}
 	if err != nil {
+		fsys.Remove(tmp)
 		return err
 	}
-
-	logrus.Printf("Copied file: %s -> %s", src, dst)
 	return nil
 }
@@ -0,0 +1,205 @@
+package op
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/logging"
+	md5 "github.com/deckarep/gorganize/file_management/md5"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// MoveFile moves src to dst following the same collision rules as CopyFile:
+// an identical file at dst means src is simply removed, a different file at
+// dst is handled according to opts.Collision. A rename is attempted first,
+// when src and dst live on different devices the file is copied, verified by
+// hash and only then removed from the source.
+func MoveFile(ctx context.Context, src, dst string, opts Options) (FileResult, error) {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	fr := FileResult{Src: src, Dst: dst}
+	if err := ctx.Err(); err != nil {
+		return fr.fail(err)
+	}
+
+	info, err := fsys.Stat(src)
+	if err != nil {
+		return fr.fail(errors.Wrap(err, "couldn't stat src file during moveFile"))
+	}
+	fr.Bytes = info.Size()
+
+	target, action, err := Resolve(ctx, fsys, src, dst, opts.Collision)
+	if err != nil {
+		return fr.fail(err)
+	}
+	if action == Existing {
+		log.Infof("Different file found:%s, keeping it and leaving source %s", filepath.Base(dst), src)
+		fr.Action = Existing
+		return fr, nil
+	}
+	if action == Identical {
+		log.Infof("Exact match found:%s, removing source %s", filepath.Base(dst), src)
+		if err := fsys.Remove(src); err != nil {
+			return fr.fail(errors.Wrap(err, "couldn't remove src file after exact match"))
+		}
+		fr.Action = Identical
+		return fr, nil
+	}
+
+	err = fsys.Rename(src, target)
+	if err != nil && !isCrossDevice(err) {
+		return fr.fail(errors.Wrap(err, "couldn't rename src file during moveFile"))
+	}
+	if err != nil {
+		log.Debugf("Cross device move of %s, falling back to copy", src)
+		if err := copyVerifyRemove(ctx, fsys, src, target); err != nil {
+			return fr.fail(err)
+		}
+	}
+
+	fr.Dst, fr.Action = target, Moved
+	switch action {
+	case Renamed:
+		fr.Action = Renamed
+		log.Infof("Similar file found:%s, moved as %s", dst, filepath.Base(target))
+	case Overwritten:
+		fr.Action = Overwritten
+		log.Infof("Different file found:%s, overwriting it", dst)
+	}
+	log.Infof("Moved file: %s -> %s", src, target)
+	return fr, nil
+}
+
+// MoveOptions controls MoveFolder.
+type MoveOptions struct {
+	// PruneEmpty removes source directories left empty by the move.
+	PruneEmpty bool
+	// Collision is what to do when a different file already has the
+	// destination name, it defaults to CollisionRename.
+	Collision Collision
+	Logger    logging.Logger
+	FS        vfs.FS
+}
+
+// MoveFolder moves every file below sourceFolder into destFolder, keeping the
+// relative layout. A file that fails to move is recorded in the result and the
+// walk carries on. destFolder can't be sourceFolder or lie below it.
+func MoveFolder(ctx context.Context, sourceFolder, destFolder string, opts MoveOptions) (*Result, error) {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	result := &Result{}
+	defer result.since(time.Now())
+
+	absSource, err := filepath.Abs(sourceFolder)
+	if err != nil {
+		return result, errors.Wrapf(err, "couldn't resolve source folder: %s", sourceFolder)
+	}
+	absDest, err := filepath.Abs(destFolder)
+	if err != nil {
+		return result, errors.Wrapf(err, "couldn't resolve dest folder: %s", destFolder)
+	}
+	if rel, err := filepath.Rel(absSource, absDest); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return result, errors.Errorf("dest folder %s is inside source folder %s", destFolder, sourceFolder)
+	}
+
+	var dirs []string
+	err = vfs.Walk(fsys, sourceFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Never walk into what was already moved.
+		if info.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && abs == absDest {
+				return filepath.SkipDir
+			}
+		}
+
+		rel, err := filepath.Rel(sourceFolder, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(destFolder, rel)
+
+		if info.IsDir() {
+			dirs = append(dirs, path)
+			return createDirIfNotExists(fsys, dest)
+		}
+
+		fr, err := MoveFile(ctx, path, dest, Options{Logger: opts.Logger, FS: opts.FS, Collision: opts.Collision})
+		if err != nil {
+			log.Errorf("Failed to move file: %s to dest %s with err: %s", path, dest, err.Error())
+		}
+		result.add(fr)
+		return nil
+	})
+	if err != nil {
+		return result, errors.Wrapf(err, "couldn't walk source folder: %s", sourceFolder)
+	}
+
+	if opts.PruneEmpty {
+		// Deepest directories first so parents become empty in turn.
+		for i := len(dirs) - 1; i >= 0; i-- {
+			removeIfEmpty(fsys, dirs[i], log)
+		}
+	}
+	return result, nil
+}
+
+func removeIfEmpty(fsys vfs.FS, dir string, log logging.Logger) {
+	infos, err := fsys.ReadDir(dir)
+	if err == nil && len(infos) == 0 {
+		if err := fsys.Remove(dir); err == nil {
+			log.Debugf("Removed empty folder: %s", dir)
+		}
+	}
+}
+
+func isCrossDevice(err error) bool {
+	if linkErr, ok := err.(*os.LinkError); ok {
+		return linkErr.Err == syscall.EXDEV
+	}
+	return false
+}
+
+func copyVerifyRemove(ctx context.Context, fsys vfs.FS, src, dst string) error {
+	in, err := fsys.Open(src)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open src file during moveFile")
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return errors.Wrap(err, "couldn't stat src file during moveFile")
+	}
+
+	if err := writeDestFile(ctx, fsys, in, dst); err != nil {
+		return err
+	}
+
+	sourceHash, err := md5.Sum(ctx, fsys, src)
+	if err != nil {
+		return errors.Wrap(err, "couldn't md5sum src during verify")
+	}
+	destHash, err := md5.Sum(ctx, fsys, dst)
+	if err != nil {
+		return errors.Wrap(err, "couldn't md5sum dest during verify")
+	}
+	if sourceHash != destHash {
+		fsys.Remove(dst)
+		return errors.Errorf("verification failed moving %s, hashes differ", src)
+	}
+
+	fsys.Chmod(dst, info.Mode())
+	fsys.Chtimes(dst, info.ModTime(), info.ModTime())
+
+	return errors.Wrap(fsys.Remove(src), "couldn't remove src file after copy")
+}
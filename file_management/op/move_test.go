@@ -0,0 +1,45 @@
+package op
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveFolderRefusesDestInsideSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "move")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "sub", "a.jpg"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dest := range []string{src, filepath.Join(src, "sub"), filepath.Join(src, "new", "dest"), src + "/sub/.."} {
+		if _, err := MoveFolder(context.Background(), src, dest, MoveOptions{}); err == nil {
+			t.Errorf("moved %s into %s", src, dest)
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(src, "sub", "a.jpg"))
+	if err != nil || string(b) != "a" {
+		t.Errorf("source changed: %q, %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "new")); !os.IsNotExist(err) {
+		t.Errorf("dest was created: %v", err)
+	}
+
+	// A sibling sharing the name's prefix is fine.
+	if _, err := MoveFolder(context.Background(), src, src+"-moved", MoveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(src+"-moved", "sub", "a.jpg")); err != nil {
+		t.Error(err)
+	}
+}
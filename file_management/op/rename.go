@@ -0,0 +1,327 @@
+package op
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/deckarep/gorganize/file_management/logging"
+	md5 "github.com/deckarep/gorganize/file_management/md5"
+	"github.com/deckarep/gorganize/file_management/meta"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// Template is a parsed rename template such as "{date:2006-01-02}_{seq:04}.{ext}".
+//
+// Supported tokens:
+//
+//	{name}         file name without extension
+//	{ext}          extension without the leading dot
+//	{parent}       name of the containing folder
+//	{date:layout}  capture date (or mtime) formatted with a Go time layout
+//	{camera}       camera model from embedded metadata
+//	{seq:width}    sequence number, zero padded to width
+//	{hash:n}       first n characters of the file's md5
+type Template struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal string
+	token   string
+	arg     string
+}
+
+// ParseTemplate validates and parses a rename template.
+func ParseTemplate(tmpl string) (*Template, error) {
+	t := &Template{}
+	rest := tmpl
+	for len(rest) > 0 {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, errors.Errorf("unterminated token in template: %s", tmpl)
+		}
+
+		token, arg := rest[open+1:open+end], ""
+		if i := strings.IndexByte(token, ':'); i >= 0 {
+			token, arg = token[:i], token[i+1:]
+		}
+
+		switch token {
+		case "name", "ext", "parent", "camera":
+		case "date":
+			if arg == "" {
+				arg = "2006-01-02"
+			}
+		case "seq", "hash":
+			if arg != "" {
+				if _, err := strconv.Atoi(arg); err != nil {
+					return nil, errors.Errorf("token {%s} expects a number, got: %s", token, arg)
+				}
+			}
+		default:
+			return nil, errors.Errorf("unknown template token: {%s}", token)
+		}
+
+		t.parts = append(t.parts, templatePart{token: token, arg: arg})
+		rest = rest[open+end+1:]
+	}
+	return t, nil
+}
+
+func (t *Template) uses(token string) bool {
+	for _, p := range t.parts {
+		if p.token == token {
+			return true
+		}
+	}
+	return false
+}
+
+// Dir returns the folder every path rendered by the template is below, the
+// literal text up to the folder holding the first token. It is "" when the
+// template starts with a token.
+func (t *Template) Dir() string {
+	var literal string
+	for _, p := range t.parts {
+		if p.token != "" {
+			i := strings.LastIndexAny(literal, "/"+string(filepath.Separator))
+			if i < 0 {
+				return ""
+			}
+			literal = literal[:i+1]
+			break
+		}
+		literal += p.literal
+	}
+	if literal == "" {
+		return ""
+	}
+	return filepath.Clean(filepath.FromSlash(literal))
+}
+
+// Execute renders the template for path. seq is the 1-based position of path
+// within the batch.
+func (t *Template) Execute(ctx context.Context, fsys vfs.FS, path string, seq int) (string, error) {
+	result, err := t.render(ctx, fsys, path, seq)
+	if err != nil {
+		return "", err
+	}
+	if result == "" || strings.ContainsRune(result, filepath.Separator) || strings.ContainsRune(result, '/') {
+		return "", errors.Errorf("template produced an invalid file name: %q", result)
+	}
+	return result, nil
+}
+
+// ExecutePath renders the template like Execute but lets it produce a path,
+// such as "{date:2006}/{date:01}/{name}.{ext}". Empty and ".." elements are
+// refused so a token can't climb out of where the template points.
+func (t *Template) ExecutePath(ctx context.Context, fsys vfs.FS, path string, seq int) (string, error) {
+	result, err := t.render(ctx, fsys, path, seq)
+	if err != nil {
+		return "", err
+	}
+	result = filepath.FromSlash(result)
+	for i, elem := range strings.Split(result, string(filepath.Separator)) {
+		if elem == ".." || (elem == "" && i > 0) {
+			return "", errors.Errorf("template produced an invalid path: %q", result)
+		}
+	}
+	if result == "" {
+		return "", errors.New("template produced an empty path")
+	}
+	return filepath.Clean(result), nil
+}
+
+func (t *Template) render(ctx context.Context, fsys vfs.FS, path string, seq int) (string, error) {
+	var info meta.Info
+	if t.uses("date") || t.uses("camera") {
+		var err error
+		if info, err = meta.Read(fsys, path); err != nil {
+			return "", err
+		}
+	}
+
+	var hash string
+	if t.uses("hash") {
+		var err error
+		if hash, err = md5.Sum(ctx, fsys, path); err != nil {
+			return "", err
+		}
+	}
+
+	name, ext := filenameAndExt(filepath.Base(path))
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.token {
+		case "":
+			b.WriteString(p.literal)
+		case "name":
+			b.WriteString(name)
+		case "ext":
+			b.WriteString(strings.TrimPrefix(ext, "."))
+		case "parent":
+			b.WriteString(filepath.Base(filepath.Dir(path)))
+		case "camera":
+			camera := info.Camera
+			if camera == "" {
+				camera = "unknown"
+			}
+			b.WriteString(camera)
+		case "date":
+			b.WriteString(info.Taken.Format(p.arg))
+		case "seq":
+			width, _ := strconv.Atoi(p.arg)
+			b.WriteString(fmt.Sprintf("%0*d", width, seq))
+		case "hash":
+			n, _ := strconv.Atoi(p.arg)
+			if n > 0 && n < len(hash) {
+				b.WriteString(hash[:n])
+			} else {
+				b.WriteString(hash)
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+// RenamePlan is a single planned rename. Conflict is non-empty when the rename
+// can't be performed safely.
+type RenamePlan struct {
+	From     string
+	To       string
+	Conflict string
+}
+
+// PlanRename renders tmpl for every file and detects conflicts before anything
+// is touched on disk. Files keep their directory, only the base name changes.
+// Templates using {hash} read every file, planning stops once ctx is done.
+func PlanRename(ctx context.Context, fsys vfs.FS, files []string, tmpl *Template) ([]RenamePlan, error) {
+	plans := make([]RenamePlan, 0, len(files))
+	targets := make(map[string]string, len(files))
+
+	for i, file := range files {
+		name, err := tmpl.Execute(ctx, fsys, file, i+1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't render template for: %s", file)
+		}
+
+		plan := RenamePlan{From: file, To: filepath.Join(filepath.Dir(file), name)}
+		if other, ok := targets[plan.To]; ok {
+			plan.Conflict = fmt.Sprintf("same target as %s", other)
+		} else if plan.To != plan.From {
+			if _, err := fsys.Lstat(plan.To); err == nil {
+				plan.Conflict = "target already exists"
+			}
+		}
+		targets[plan.To] = file
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// journalEntry is one line of an undo journal.
+type journalEntry struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ApplyRename performs the planned renames. Each rename is recorded in the
+// journal file before it happens so an interrupted batch can still be undone.
+// Plans with conflicts are refused up front.
+func ApplyRename(ctx context.Context, plans []RenamePlan, journalPath string, opts Options) error {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	for _, p := range plans {
+		if p.Conflict != "" {
+			return errors.Errorf("refusing to rename, conflict on %s: %s", p.From, p.Conflict)
+		}
+	}
+
+	journal, err := fsys.OpenFile(journalPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open rename journal")
+	}
+	defer journal.Close()
+
+	enc := json.NewEncoder(journal)
+	for _, p := range plans {
+		if p.From == p.To {
+			continue
+		}
+		// Stopping between renames leaves a consistent journal to undo.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := enc.Encode(journalEntry{From: p.From, To: p.To}); err != nil {
+			return errors.Wrap(err, "couldn't write rename journal")
+		}
+		if err := journal.Sync(); err != nil {
+			return errors.Wrap(err, "couldn't sync rename journal")
+		}
+		if err := fsys.Rename(p.From, p.To); err != nil {
+			return errors.Wrapf(err, "couldn't rename %s", p.From)
+		}
+		log.Infof("Renamed file: %s -> %s", p.From, p.To)
+	}
+	return nil
+}
+
+// UndoRename reverts the renames recorded in a journal, newest first, and
+// removes the journal once everything has been restored.
+func UndoRename(journalPath string, opts Options) error {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	journal, err := fsys.Open(journalPath)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open rename journal")
+	}
+	defer journal.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(journal)
+	for scanner.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return errors.Wrap(err, "corrupt rename journal")
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "couldn't read rename journal")
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if _, err := fsys.Lstat(e.To); os.IsNotExist(err) {
+			// The rename never happened or was already undone.
+			continue
+		}
+		if _, err := fsys.Lstat(e.From); err == nil {
+			return errors.Errorf("can't undo %s, original path is occupied", e.To)
+		}
+		if err := fsys.Rename(e.To, e.From); err != nil {
+			return errors.Wrapf(err, "couldn't undo rename of %s", e.To)
+		}
+		log.Infof("Restored file: %s -> %s", e.To, e.From)
+	}
+
+	// Everything has been reverted, a stale journal would only confuse the next batch.
+	journal.Close()
+	return errors.Wrap(fsys.Remove(journalPath), "couldn't remove rename journal")
+}
@@ -0,0 +1,143 @@
+package op
+
+import (
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/logging"
+	"github.com/deckarep/gorganize/file_management/progress"
+	"github.com/deckarep/gorganize/file_management/vfs"
+)
+
+// Options are shared by the operations on single files.
+type Options struct {
+	// Logger receives what the operation does, it defaults to logging.Default.
+	Logger logging.Logger
+	// FS is the filesystem operated on, it defaults to vfs.OS.
+	FS vfs.FS
+	// Progress receives progress events, nil reports nothing.
+	Progress progress.Reporter
+	// Collision is what to do when dst holds different content, it defaults
+	// to CollisionRename.
+	Collision Collision
+}
+
+// Action is what an operation ended up doing with a single file.
+type Action string
+
+const (
+	// Copied means the file was written to its destination.
+	Copied Action = "copied"
+	// Moved means the file was moved to its destination.
+	Moved Action = "moved"
+	// Renamed means a different file already had the destination name, the
+	// file was written next to it with a hash suffix.
+	Renamed Action = "renamed"
+	// Identical means the destination already held the same content.
+	Identical Action = "skipped-identical"
+	// Existing means the destination held different content and was kept
+	// under CollisionSkip.
+	Existing Action = "skipped-existing"
+	// Overwritten means the destination held different content and was
+	// replaced under CollisionOverwrite.
+	Overwritten Action = "overwritten"
+	// Failed means the operation failed, see Err.
+	Failed Action = "failed"
+)
+
+// FileResult is the outcome of an operation on a single file.
+type FileResult struct {
+	Src    string
+	Dst    string
+	Action Action
+	Bytes  int64
+	Err    error
+}
+
+// Result collects the outcomes of an operation over many files.
+type Result struct {
+	Files []FileResult
+	// Elapsed is how long the operation took.
+	Elapsed time.Duration
+}
+
+func (r *Result) add(fr FileResult) {
+	r.Files = append(r.Files, fr)
+}
+
+// Count returns how many files ended with action.
+func (r *Result) Count(action Action) int {
+	n := 0
+	for _, fr := range r.Files {
+		if fr.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Bytes is the total size of the files written.
+func (r *Result) Bytes() int64 {
+	var n int64
+	for _, fr := range r.Files {
+		if fr.Action != Identical && fr.Action != Existing && fr.Action != Failed {
+			n += fr.Bytes
+		}
+	}
+	return n
+}
+
+// since records the time elapsed since start, deferred by operations.
+func (r *Result) since(start time.Time) {
+	r.Elapsed = time.Since(start)
+}
+
+// Stats sums up what an operation did.
+type Stats struct {
+	Copied  int
+	Moved   int
+	Renamed int
+	// Skipped counts identical files as well as existing ones kept under
+	// CollisionSkip.
+	Skipped     int
+	Overwritten int
+	Failed      int
+	// Bytes is the total size of the files written.
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// Stats sums up r.
+func (r *Result) Stats() Stats {
+	return Stats{
+		Copied:      r.Count(Copied),
+		Moved:       r.Count(Moved),
+		Renamed:     r.Count(Renamed),
+		Skipped:     r.Count(Identical) + r.Count(Existing),
+		Overwritten: r.Count(Overwritten),
+		Failed:      r.Count(Failed),
+		Bytes:       r.Bytes(),
+		Elapsed:     r.Elapsed,
+	}
+}
+
+// Add combines the stats of two operations.
+func (s Stats) Add(o Stats) Stats {
+	return Stats{
+		Copied:      s.Copied + o.Copied,
+		Moved:       s.Moved + o.Moved,
+		Renamed:     s.Renamed + o.Renamed,
+		Skipped:     s.Skipped + o.Skipped,
+		Overwritten: s.Overwritten + o.Overwritten,
+		Failed:      s.Failed + o.Failed,
+		Bytes:       s.Bytes + o.Bytes,
+		Elapsed:     s.Elapsed + o.Elapsed,
+	}
+}
+
+// fail marks fr as failed with err and returns both, for the single file
+// operations.
+func (fr FileResult) fail(err error) (FileResult, error) {
+	fr.Action = Failed
+	fr.Err = err
+	return fr, err
+}
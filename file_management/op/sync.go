@@ -0,0 +1,263 @@
+package op
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/logging"
+	md5 "github.com/deckarep/gorganize/file_management/md5"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// SyncOptions controls how SyncFolder makes dest reflect source.
+type SyncOptions struct {
+	// Checksum additionally compares files with equal size and mtime by md5.
+	Checksum bool
+	// Delete removes files in dest that don't exist in source.
+	Delete bool
+	// DryRun only reports what would happen.
+	DryRun bool
+	Logger logging.Logger
+	FS     vfs.FS
+}
+
+// SyncReport summarizes a SyncFolder run.
+type SyncReport struct {
+	Added     []string
+	Updated   []string
+	Deleted   []string
+	Unchanged int
+	Failed    int
+	Bytes     int64
+	// Errors holds why each of the Failed files failed.
+	Errors []error
+	// Elapsed is how long the sync took.
+	Elapsed time.Duration
+}
+
+func (r *SyncReport) fail(err error) {
+	r.Failed++
+	r.Errors = append(r.Errors, err)
+}
+
+// SyncFolder makes destFolder mirror sourceFolder. Files are compared by size
+// and modification time, and optionally by hash. New and changed files are
+// copied with their modification time preserved so the next run sees them as
+// unchanged.
+func SyncFolder(ctx context.Context, sourceFolder, destFolder string, opts SyncOptions) (*SyncReport, error) {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	report := &SyncReport{}
+	start := time.Now()
+	defer func() { report.Elapsed = time.Since(start) }()
+	sourceFiles := make(map[string]os.FileInfo)
+
+	err := vfs.Walk(fsys, sourceFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			rel, err := filepath.Rel(sourceFolder, path)
+			if err != nil {
+				return err
+			}
+			sourceFiles[rel] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't walk source folder: %s", sourceFolder)
+	}
+
+	rels := make([]string, 0, len(sourceFiles))
+	for rel := range sourceFiles {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	var suspects []string
+	for _, rel := range rels {
+		srcInfo := sourceFiles[rel]
+		destInfo, err := fsys.Stat(filepath.Join(destFolder, rel))
+		switch {
+		case os.IsNotExist(err):
+			report.Added = append(report.Added, rel)
+		case err != nil:
+			log.Errorf("Couldn't stat dest file: %s with err: %s", rel, err)
+			report.fail(errors.Wrapf(err, "couldn't stat dest file: %s", rel))
+		case destInfo.Size() != srcInfo.Size() || !destInfo.ModTime().Equal(srcInfo.ModTime()):
+			report.Updated = append(report.Updated, rel)
+		case opts.Checksum:
+			suspects = append(suspects, rel)
+		default:
+			report.Unchanged++
+		}
+	}
+
+	if len(suspects) > 0 {
+		changed := changedByHash(ctx, fsys, sourceFolder, destFolder, suspects)
+		report.Updated = append(report.Updated, changed...)
+		report.Unchanged += len(suspects) - len(changed)
+		sort.Strings(report.Updated)
+	}
+
+	for _, list := range []*[]string{&report.Added, &report.Updated} {
+		for i, rel := range *list {
+			if err := ctx.Err(); err != nil && !opts.DryRun {
+				// Files that weren't synced yet aren't reported.
+				*list = (*list)[:i]
+				if list == &report.Added {
+					report.Updated = nil
+				}
+				return report, err
+			}
+			report.Bytes += sourceFiles[rel].Size()
+			if opts.DryRun {
+				continue
+			}
+			src, dst := filepath.Join(sourceFolder, rel), filepath.Join(destFolder, rel)
+			if err := syncFile(fsys, src, dst, sourceFiles[rel]); err != nil {
+				log.Errorf("Failed to sync file: %s to dest %s with err: %s", src, dst, err)
+				report.fail(errors.Wrapf(err, "couldn't sync: %s", rel))
+				continue
+			}
+			log.Infof("Synced file: %s -> %s", src, dst)
+		}
+	}
+
+	if opts.Delete {
+		if err := deleteExtraneous(ctx, fsys, destFolder, sourceFiles, opts.DryRun, log, report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// changedByHash hashes both sides of every suspect in parallel and returns the
+// ones whose content differs.
+func changedByHash(ctx context.Context, fsys vfs.FS, sourceFolder, destFolder string, rels []string) []string {
+	producerChan, receiverChan := md5.PSum(ctx, fsys, 0, nil)
+
+	go func() {
+		for _, rel := range rels {
+			producerChan <- filepath.Join(sourceFolder, rel)
+			producerChan <- filepath.Join(destFolder, rel)
+		}
+		close(producerChan)
+	}()
+
+	hashes := make(map[string]string, len(rels)*2)
+	for result := range receiverChan {
+		if result.Err == nil {
+			hashes[result.Name] = result.Hash
+		}
+	}
+
+	var changed []string
+	for _, rel := range rels {
+		srcHash := hashes[filepath.Join(sourceFolder, rel)]
+		dstHash := hashes[filepath.Join(destFolder, rel)]
+		// A missing hash means it couldn't be computed, err on the side of copying.
+		if srcHash == "" || srcHash != dstHash {
+			changed = append(changed, rel)
+		}
+	}
+	return changed
+}
+
+// syncFile copies src over dst through a temporary file so an interrupted
+// sync never leaves a truncated file behind.
+func syncFile(fsys vfs.FS, src, dst string, info os.FileInfo) error {
+	if err := createDirIfNotExists(fsys, filepath.Dir(dst)); err != nil {
+		return err
+	}
+
+	in, err := fsys.Open(src)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open src file during sync")
+	}
+	defer in.Close()
+
+	tmp := dst + ".gorganize-tmp"
+	out, err := fsys.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return errors.Wrap(err, "couldn't create temp file during sync")
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		fsys.Remove(tmp)
+		return errors.Wrap(err, "couldn't io.Copy during sync")
+	}
+	if err := out.Close(); err != nil {
+		fsys.Remove(tmp)
+		return errors.Wrap(err, "couldn't close temp file during sync")
+	}
+
+	if err := fsys.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		fsys.Remove(tmp)
+		return errors.Wrap(err, "couldn't set modification time during sync")
+	}
+	return errors.Wrap(fsys.Rename(tmp, dst), "couldn't move temp file into place")
+}
+
+func deleteExtraneous(ctx context.Context, fsys vfs.FS, destFolder string, sourceFiles map[string]os.FileInfo, dryRun bool, log logging.Logger, report *SyncReport) error {
+	var extraneous, dirs []string
+	err := vfs.Walk(fsys, destFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == destFolder {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if path == destFolder {
+			return nil
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+
+		rel, err := filepath.Rel(destFolder, path)
+		if err != nil {
+			return err
+		}
+		if _, ok := sourceFiles[rel]; !ok {
+			extraneous = append(extraneous, path)
+			report.Deleted = append(report.Deleted, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "couldn't walk dest folder: %s", destFolder)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	for _, path := range extraneous {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fsys.Remove(path); err != nil {
+			log.Errorf("Failed to delete extraneous file: %s with err: %s", path, err)
+			report.fail(errors.Wrapf(err, "couldn't delete: %s", path))
+			continue
+		}
+		log.Infof("Deleted file: %s", path)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		removeIfEmpty(fsys, dirs[i], log)
+	}
+	return nil
+}
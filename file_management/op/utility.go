@@ -1,10 +1,16 @@
 package op
 
 import (
+	"context"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
 )
 
 func filenameAndExt(path string) (string, string) {
@@ -13,11 +19,78 @@ func filenameAndExt(path string) (string, string) {
 	return justName, justExt
 }
 
-func createDirIfNotExists(path string) {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err := os.MkdirAll(path, 0777)
+func createDirIfNotExists(fsys vfs.FS, path string) error {
+	if _, err := fsys.Stat(path); os.IsNotExist(err) {
+		return errors.Wrapf(fsys.MkdirAll(path, 0777), "couldn't create destination dir: %s", path)
+	}
+	return nil
+}
+
+// contextReader reads from r until ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// sizeUnits are the suffixes ParseSize understands, longest first. Units are
+// binary, 1KB is 1024 bytes, the way file managers count.
+var sizeUnits = []struct {
+	suffix string
+	size   float64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize reads a size such as 512, 10KB or 1.5GB.
+func ParseSize(s string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	text = strings.Replace(text, "IB", "B", 1)
+	unit := 1.0
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(text, u.suffix) {
+			text, unit = strings.TrimSpace(strings.TrimSuffix(text, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid size: %s", s)
+	}
+	return int64(n * unit), nil
+}
+
+// dateLayouts are the precisions ParseDate understands, with how far each
+// one spans.
+var dateLayouts = []struct {
+	layout              string
+	years, months, days int
+}{
+	{"2006-01-02", 0, 0, 1},
+	{"2006-01", 0, 1, 0},
+	{"2006", 1, 0, 0},
+}
+
+// ParseDate reads a local date given as 2006, 2006-01 or 2006-01-02 and
+// returns the period it covers, from start up to but excluding end.
+func ParseDate(s string) (start, end time.Time, err error) {
+	for _, l := range dateLayouts {
+		if len(s) != len(l.layout) {
+			continue
+		}
+		start, err := time.ParseInLocation(l.layout, s, time.Local)
 		if err != nil {
-			logrus.Fatalf("Couldn't create destination dir:%s with err: %s", path, err)
+			break
 		}
+		return start, start.AddDate(l.years, l.months, l.days), nil
 	}
+	return time.Time{}, time.Time{}, errors.Errorf("invalid date: %s, expected 2006, 2006-01 or 2006-01-02", s)
 }
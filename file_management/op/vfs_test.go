@@ -0,0 +1,201 @@
+package op
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/deckarep/gorganize/file_management/vfs"
+)
+
+// tree writes files, by path, into fsys.
+func tree(t *testing.T, fsys vfs.FS, files map[string]string) {
+	t.Helper()
+	for path, body := range files {
+		if err := fsys.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := vfs.WriteFile(fsys, path, []byte(body), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// files lists the regular files below root on fsys with their content, a
+// missing root has none.
+func files(t *testing.T, fsys vfs.FS, root string) map[string]string {
+	t.Helper()
+	found := make(map[string]string)
+	if _, err := fsys.Lstat(root); os.IsNotExist(err) {
+		return found
+	}
+	err := vfs.Walk(fsys, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			b, err := vfs.ReadFile(fsys, path)
+			if err != nil {
+				return err
+			}
+			found[path] = string(b)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func assertFiles(t *testing.T, got, want map[string]string) {
+	t.Helper()
+	var paths []string
+	for path := range want {
+		paths = append(paths, path)
+	}
+	for path := range got {
+		if _, ok := want[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		g, gok := got[path]
+		w, wok := want[path]
+		switch {
+		case !gok:
+			t.Errorf("%s is missing", path)
+		case !wok:
+			t.Errorf("unexpected %s", path)
+		case g != w:
+			t.Errorf("%s holds %q, want %q", path, g, w)
+		}
+	}
+}
+
+func TestFlattenMem(t *testing.T) {
+	fsys := vfs.NewMem()
+	tree(t, fsys, map[string]string{
+		"/src/a/one.jpg":  "one",
+		"/src/b/one.jpg":  "other one",
+		"/src/b/two.JPG":  "two",
+		"/src/b/skip.txt": "text",
+		"/src/c/dup.jpg":  "one",
+	})
+
+	opts := FlattenOptions{Extensions: mapset.NewThreadUnsafeSetFromSlice([]interface{}{".jpg"}), FS: fsys}
+	result, err := FlattenFolderByExtension(context.Background(), "/src", "/dst", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := result.Stats()
+	if stats.Copied != 3 || stats.Renamed != 1 || stats.Failed != 0 {
+		t.Errorf("got %+v, want 3 copied and 1 renamed", stats)
+	}
+	got := files(t, fsys, "/dst")
+	if len(got) != 4 || got["/dst/one.jpg"] != "one" || got["/dst/two.jpg"] != "two" || got["/dst/dup.jpg"] != "one" {
+		t.Errorf("flattened into %v", got)
+	}
+	if len(files(t, fsys, "/src")) != 5 {
+		t.Error("flatten changed the source")
+	}
+}
+
+func TestFlattenMemAllFiles(t *testing.T) {
+	fsys := vfs.NewMem()
+	tree(t, fsys, map[string]string{
+		"/src/a/one.jpg":  "one",
+		"/src/b/note.txt": "text",
+	})
+
+	// A zero value FlattenOptions flattens every file.
+	if _, err := FlattenFolderByExtension(context.Background(), "/src", "/dst", FlattenOptions{FS: fsys}); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, files(t, fsys, "/dst"), map[string]string{
+		"/dst/one.jpg":  "one",
+		"/dst/note.txt": "text",
+	})
+}
+
+func TestMoveFolderMem(t *testing.T) {
+	tests := []struct {
+		collision Collision
+		want      map[string]string
+	}{
+		{CollisionSkip, map[string]string{
+			"/dst/a.jpg":     "kept",
+			"/dst/sub/b.jpg": "b",
+			"/dst/same.jpg":  "same",
+		}},
+		{CollisionOverwrite, map[string]string{
+			"/dst/a.jpg":     "new",
+			"/dst/sub/b.jpg": "b",
+			"/dst/same.jpg":  "same",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.collision), func(t *testing.T) {
+			fsys := vfs.NewMem()
+			tree(t, fsys, map[string]string{
+				"/src/a.jpg":     "new",
+				"/src/sub/b.jpg": "b",
+				"/src/same.jpg":  "same",
+				"/dst/a.jpg":     "kept",
+				"/dst/same.jpg":  "same",
+			})
+
+			opts := MoveOptions{FS: fsys, Collision: tt.collision, PruneEmpty: true}
+			if _, err := MoveFolder(context.Background(), "/src", "/dst", opts); err != nil {
+				t.Fatal(err)
+			}
+			assertFiles(t, files(t, fsys, "/dst"), tt.want)
+
+			left := files(t, fsys, "/src")
+			if tt.collision == CollisionSkip {
+				assertFiles(t, left, map[string]string{"/src/a.jpg": "new"})
+			} else {
+				assertFiles(t, left, map[string]string{})
+				if _, err := fsys.Stat("/src"); !os.IsNotExist(err) {
+					t.Errorf("emptied /src wasn't pruned: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestMoveFolderOverlay(t *testing.T) {
+	base := vfs.NewMem()
+	tree(t, base, map[string]string{
+		"/src/a.jpg":     "a",
+		"/src/sub/b.jpg": "b",
+	})
+	fsys := vfs.Overlay(base, vfs.NewMem())
+
+	result, err := MoveFolder(context.Background(), "/src", "/dst", MoveOptions{FS: fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := result.Count(Moved); n != 2 {
+		t.Errorf("moved %d files, want 2", n)
+	}
+
+	// The overlay shows the move, base doesn't see any of it.
+	assertFiles(t, files(t, fsys, "/dst"), map[string]string{
+		"/dst/a.jpg":     "a",
+		"/dst/sub/b.jpg": "b",
+	})
+	assertFiles(t, files(t, fsys, "/src"), map[string]string{})
+	assertFiles(t, files(t, base, "/src"), map[string]string{
+		"/src/a.jpg":     "a",
+		"/src/sub/b.jpg": "b",
+	})
+	if _, err := base.Stat("/dst"); !os.IsNotExist(err) {
+		t.Errorf("base gained /dst: %v", err)
+	}
+}
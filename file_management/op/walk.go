@@ -0,0 +1,87 @@
+package op
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// Filter selects files by glob patterns matched case insensitively against
+// their base name. A file is selected when it matches any Include pattern, or
+// Include is empty, and matches no Exclude pattern. Directories matching an
+// Exclude pattern are skipped entirely.
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+// Validate reports the first malformed pattern.
+func (f Filter) Validate() error {
+	for _, patterns := range [][]string{f.Include, f.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return errors.Wrapf(err, "invalid pattern: %s", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Match reports whether a file named name is selected.
+func (f Filter) Match(name string) bool {
+	if matchAny(f.Exclude, name) {
+		return false
+	}
+	return len(f.Include) == 0 || matchAny(f.Include, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// WalkFiles calls fn for every regular file below root selected by filter.
+func WalkFiles(fsys vfs.FS, root string, filter Filter, fn func(path string, info os.FileInfo) error) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	return vfs.Walk(fsys, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && matchAny(filter.Exclude, info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || !filter.Match(info.Name()) {
+			return nil
+		}
+		return fn(path, info)
+	})
+}
+
+// CollectFiles expands roots into a lexically ordered list of regular files
+// selected by filter. Directories are walked recursively.
+func CollectFiles(fsys vfs.FS, roots []string, filter Filter) ([]string, error) {
+	var files []string
+	for _, root := range roots {
+		err := WalkFiles(fsys, root, filter, func(path string, info os.FileInfo) error {
+			files = append(files, path)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't walk: %s", root)
+		}
+	}
+	return files, nil
+}
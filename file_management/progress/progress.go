@@ -0,0 +1,208 @@
+// Package progress lets long running operations report how far along they
+// are. Operations take a Reporter in their options and feed a Tracker, which
+// turns counts into Events with throughput and an ETA.
+package progress
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Event is a snapshot of an operation's progress.
+type Event struct {
+	// Op names the operation, such as "flatten" or "md5".
+	Op string
+	// Current is the file being worked on.
+	Current string
+
+	FilesDiscovered int64
+	FilesProcessed  int64
+	FilesSkipped    int64
+	FilesFailed     int64
+	BytesDiscovered int64
+	BytesProcessed  int64
+
+	Elapsed time.Duration
+	// Throughput is the recent rate in bytes per second.
+	Throughput float64
+	// ETA is the estimated time left, negative when unknown.
+	ETA time.Duration
+	// Done is set on the final event.
+	Done bool
+}
+
+// Files is how many files have been dealt with one way or another.
+func (e Event) Files() int64 {
+	return e.FilesProcessed + e.FilesSkipped + e.FilesFailed
+}
+
+// Reporter receives progress events. Calls are serialized by the Tracker.
+type Reporter interface {
+	Progress(Event)
+}
+
+// ReporterFunc adapts a function to a Reporter.
+type ReporterFunc func(Event)
+
+// Progress calls f.
+func (f ReporterFunc) Progress(e Event) {
+	f(e)
+}
+
+// Interval is the most often a Tracker emits intermediate events.
+const Interval = 100 * time.Millisecond
+
+// smoothing weighs the newest throughput sample against the previous rate.
+const smoothing = 0.3
+
+// Tracker accumulates the progress of one operation and emits Events to its
+// Reporter, at most every Interval apart. A nil *Tracker, or one without a
+// Reporter, does nothing so operations can report unconditionally. It is safe
+// for concurrent use.
+type Tracker struct {
+	mu       sync.Mutex
+	reporter Reporter
+	event    Event
+	start    time.Time
+	last     time.Time
+	lastSent int64
+	rate     float64
+}
+
+// NewTracker starts tracking op, returning nil when r is nil.
+func NewTracker(op string, r Reporter) *Tracker {
+	if r == nil {
+		return nil
+	}
+	now := time.Now()
+	return &Tracker{reporter: r, event: Event{Op: op, ETA: -1}, start: now, last: now}
+}
+
+// Discovered adds files, holding bytes in total, to the work to be done.
+func (t *Tracker) Discovered(files int, bytes int64) {
+	t.update(func(e *Event) {
+		e.FilesDiscovered += int64(files)
+		e.BytesDiscovered += bytes
+	}, false)
+}
+
+// Start marks path as the file being worked on.
+func (t *Tracker) Start(path string) {
+	t.update(func(e *Event) { e.Current = path }, false)
+}
+
+// Bytes counts n bytes of the current file as processed.
+func (t *Tracker) Bytes(n int64) {
+	t.update(func(e *Event) { e.BytesProcessed += n }, false)
+}
+
+// Processed counts a file as done, remaining is how many of its bytes weren't
+// already counted through Bytes.
+func (t *Tracker) Processed(remaining int64) {
+	t.update(func(e *Event) {
+		e.FilesProcessed++
+		e.BytesProcessed += remaining
+	}, false)
+}
+
+// Skipped counts a file as skipped, its bytes still count as dealt with.
+func (t *Tracker) Skipped(bytes int64) {
+	t.update(func(e *Event) {
+		e.FilesSkipped++
+		e.BytesProcessed += bytes
+	}, false)
+}
+
+// Failed counts a file as failed, its bytes still count as dealt with.
+func (t *Tracker) Failed(bytes int64) {
+	t.update(func(e *Event) {
+		e.FilesFailed++
+		e.BytesProcessed += bytes
+	}, false)
+}
+
+// Done emits the final event.
+func (t *Tracker) Done() {
+	t.update(func(e *Event) {
+		e.Done = true
+		e.Current = ""
+		e.ETA = 0
+	}, true)
+}
+
+// Reader wraps r so bytes read from it are counted as processed.
+func (t *Tracker) Reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &reader{r: r, t: t}
+}
+
+func (t *Tracker) update(fn func(*Event), force bool) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.event.Done {
+		return
+	}
+	fn(&t.event)
+
+	now := time.Now()
+	if !force && now.Sub(t.last) < Interval {
+		return
+	}
+	t.sample(now)
+	t.reporter.Progress(t.event)
+}
+
+// sample refreshes the throughput and ETA. t.mu must be held.
+func (t *Tracker) sample(now time.Time) {
+	e := &t.event
+	e.Elapsed = now.Sub(t.start)
+
+	if window := now.Sub(t.last).Seconds(); window > 0 {
+		current := float64(e.BytesProcessed-t.lastSent) / window
+		if t.rate == 0 {
+			t.rate = current
+		} else {
+			t.rate = smoothing*current + (1-smoothing)*t.rate
+		}
+	}
+	t.last = now
+	t.lastSent = e.BytesProcessed
+	e.Throughput = t.rate
+
+	if e.Done {
+		return
+	}
+	e.ETA = -1
+	switch {
+	case e.BytesDiscovered > 0 && t.rate > 0:
+		left := e.BytesDiscovered - e.BytesProcessed
+		if left < 0 {
+			left = 0
+		}
+		e.ETA = time.Duration(float64(left) / t.rate * float64(time.Second))
+	case e.FilesDiscovered > 0 && e.Files() > 0:
+		perFile := e.Elapsed / time.Duration(e.Files())
+		e.ETA = perFile * time.Duration(e.FilesDiscovered-e.Files())
+	}
+}
+
+type reader struct {
+	r io.Reader
+	t *Tracker
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.t.Bytes(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,614 @@
+package rules
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/logging"
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/deckarep/gorganize/file_management/progress"
+	"github.com/deckarep/gorganize/file_management/tags"
+	"github.com/deckarep/gorganize/file_management/unzip"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// What apply did with a file, on top of the op actions copy and move report.
+const (
+	// Planned means the action would have been carried out under DryRun.
+	Planned op.Action = "planned"
+	// Extracted means the archive was extracted.
+	Extracted op.Action = "extracted"
+	// Deleted means the file was moved into the trash, or removed when there
+	// is none.
+	Deleted op.Action = "deleted"
+	// Tagged means tags were added to the file.
+	Tagged op.Action = "tagged"
+)
+
+// Options controls Apply.
+type Options struct {
+	// Dest overrides the destination of the rules.
+	Dest string
+	// DryRun reports what each rule would do without touching anything.
+	// Later rules see a file where it was, not where it would have gone.
+	DryRun bool
+	// Journal is the file every action carried out is appended to, so the
+	// run can be undone. Empty keeps no journal.
+	Journal string
+	// Trash is the folder deleted files are moved into so Undo can bring them
+	// back, it defaults to the journal's path with ".trash" appended. Without
+	// either deleted files are removed for good.
+	Trash string
+	// Collision is what to do when a different file already has the
+	// destination name, it defaults to op.CollisionRename.
+	Collision op.Collision
+	Logger    logging.Logger
+	FS        vfs.FS
+	// Progress receives progress events counted in files, nil reports
+	// nothing.
+	Progress progress.Reporter
+}
+
+// Outcome is what a rule did with a file.
+type Outcome struct {
+	Rule   string
+	Action Action
+	Src    string
+	// Dst is where the file went, the folder an archive was extracted to or
+	// where a deleted file is kept in the trash.
+	Dst string
+	// Result is what happened, an op.Action such as op.Copied or
+	// op.Identical, or one of Planned, Extracted, Deleted and Tagged.
+	Result op.Action
+	// Tags are the tags added by a tag rule.
+	Tags []string
+	// Written are the files an extract rule created.
+	Written []string
+	// Replaced are the files in Written that overwrote a different file.
+	Replaced []string
+	Bytes    int64
+	Err      error
+}
+
+// Result is the outcome of Apply.
+type Result struct {
+	Outcomes []Outcome
+	// Files counts the files evaluated, Unmatched those no rule matched.
+	Files     int
+	Unmatched int
+	// Done are the files no rule failed on, by the path they were found at.
+	// Files not reached before ctx was done aren't listed.
+	Done    []string
+	Elapsed time.Duration
+}
+
+// Stats sums up an Apply.
+type Stats struct {
+	Files     int
+	Unmatched int
+	// Copied to Tagged count the rules carried out by their action.
+	Copied    int
+	Moved     int
+	Renamed   int
+	Extracted int
+	Deleted   int
+	Tagged    int
+	Planned   int
+	// Skipped counts files whose destination already held them, or held a
+	// different file kept under op.CollisionSkip.
+	Skipped int
+	Failed  int
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// Stats sums up r.
+func (r *Result) Stats() Stats {
+	s := Stats{Files: r.Files, Unmatched: r.Unmatched, Elapsed: r.Elapsed}
+	for _, o := range r.Outcomes {
+		switch o.Result {
+		case op.Failed:
+			s.Failed++
+			continue
+		case op.Identical, op.Existing:
+			s.Skipped++
+			continue
+		case Planned:
+			s.Planned++
+			continue
+		}
+		s.Bytes += o.Bytes
+		switch o.Action {
+		case Copy:
+			s.Copied++
+		case Move:
+			s.Moved++
+		case Rename:
+			s.Renamed++
+		case Extract:
+			s.Extracted++
+		case Delete:
+			s.Deleted++
+		case Tag:
+			s.Tagged++
+		}
+	}
+	return s
+}
+
+// Add combines the stats of two runs.
+func (s Stats) Add(o Stats) Stats {
+	return Stats{
+		Files:     s.Files + o.Files,
+		Unmatched: s.Unmatched + o.Unmatched,
+		Copied:    s.Copied + o.Copied,
+		Moved:     s.Moved + o.Moved,
+		Renamed:   s.Renamed + o.Renamed,
+		Extracted: s.Extracted + o.Extracted,
+		Deleted:   s.Deleted + o.Deleted,
+		Tagged:    s.Tagged + o.Tagged,
+		Planned:   s.Planned + o.Planned,
+		Skipped:   s.Skipped + o.Skipped,
+		Failed:    s.Failed + o.Failed,
+		Bytes:     s.Bytes + o.Bytes,
+		Elapsed:   s.Elapsed + o.Elapsed,
+	}
+}
+
+// Apply runs every file below sources through the rules, or below the sources
+// of the rules when none are given. Files are collected before any rule runs
+// so files a rule creates below a source aren't picked up again. A rule that
+// fails on a file is recorded in the result and the run carries on, the
+// returned error is reserved for failing to walk the sources, to write the
+// journal, or ctx being done.
+func Apply(ctx context.Context, rs *Rules, sources []string, opts Options) (*Result, error) {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	result := &Result{}
+	start := time.Now()
+	defer func() { result.Elapsed = time.Since(start) }()
+	tracker := progress.NewTracker("apply", opts.Progress)
+	defer tracker.Done()
+
+	if len(sources) == 0 {
+		sources = rs.Sources
+	}
+	if len(sources) == 0 {
+		return result, errors.New("no sources to apply the rules to")
+	}
+	if opts.Dest == "" {
+		opts.Dest = rs.Dest
+	}
+	if opts.Trash == "" && opts.Journal != "" {
+		opts.Trash = opts.Journal + ".trash"
+	}
+
+	// The sidecars of tag rules and leftovers of interrupted copies aren't
+	// anybody's files.
+	filter := op.Filter{Exclude: []string{tags.FileName, "*.gorganize-tmp"}}
+	paths, err := op.CollectFiles(fsys, sources, filter)
+	if err != nil {
+		return result, err
+	}
+	var files []*file
+	for _, path := range paths {
+		if opts.Journal != "" && filepath.Clean(path) == filepath.Clean(opts.Journal) {
+			continue
+		}
+		if opts.Trash != "" && inside(path, opts.Trash) {
+			continue
+		}
+		f := &file{path: path}
+		if info, err := fsys.Stat(path); err == nil {
+			f.size = info.Size()
+		}
+		files = append(files, f)
+		tracker.Discovered(1, f.size)
+	}
+
+	var journal *applyJournal
+	if opts.Journal != "" && !opts.DryRun {
+		if journal, err = openJournal(fsys, opts.Journal); err != nil {
+			return result, err
+		}
+		defer journal.close()
+	}
+
+	seq := make(map[*Rule]int)
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		tracker.Start(f.path)
+		result.Files++
+		found := f.path
+
+		matched, failed := false, false
+		for _, rule := range rs.Rules {
+			ok, err := rule.matches(fsys, f)
+			if err != nil {
+				log.Errorf("Couldn't match %s against rule %s: %s", f.path, rule, err)
+				result.Outcomes = append(result.Outcomes, Outcome{Rule: rule.String(), Action: rule.Action, Src: f.path, Result: op.Failed, Err: err})
+				failed = true
+				break
+			}
+			if !ok {
+				continue
+			}
+			matched = true
+			seq[rule]++
+
+			o := apply(ctx, rule, f, seq[rule], opts)
+			result.Outcomes = append(result.Outcomes, o)
+			if o.Result == op.Failed {
+				log.Errorf("Rule %s failed on %s: %s", rule, f.path, o.Err)
+				failed = true
+				break
+			}
+			if err := journal.record(o); err != nil {
+				return result, err
+			}
+			if !rule.Continue || rule.Action == Delete {
+				break
+			}
+			if !opts.DryRun && (rule.Action == Move || rule.Action == Rename) && o.Result != op.Existing {
+				f.path = o.Dst
+			}
+		}
+
+		switch {
+		case failed:
+			tracker.Failed(f.size)
+		case !matched:
+			result.Unmatched++
+			tracker.Skipped(f.size)
+		default:
+			tracker.Processed(f.size)
+		}
+		if !failed {
+			result.Done = append(result.Done, found)
+		}
+	}
+	return result, nil
+}
+
+// apply carries out rule on f, the seq-th file it matched.
+func apply(ctx context.Context, rule *Rule, f *file, seq int, opts Options) Outcome {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	o := Outcome{Rule: rule.String(), Action: rule.Action, Src: f.path, Bytes: f.size}
+	fail := func(err error) Outcome {
+		o.Result, o.Err = op.Failed, err
+		return o
+	}
+
+	var err error
+	switch rule.Action {
+	case Copy, Move, Extract:
+		if o.Dst, err = target(ctx, rule, f.path, seq, opts); err != nil {
+			return fail(err)
+		}
+	case Rename:
+		name, err := rule.Filename.Execute(ctx, fsys, f.path, seq)
+		if err != nil {
+			return fail(err)
+		}
+		o.Dst = filepath.Join(filepath.Dir(f.path), name)
+	}
+
+	if opts.DryRun {
+		o.Result, o.Tags = Planned, rule.Tags
+		log.Debugf("Would %s: %s %s", rule.Action, f.path, o.Dst)
+		return o
+	}
+
+	fileOpts := op.Options{Logger: opts.Logger, FS: opts.FS, Collision: opts.Collision}
+	switch rule.Action {
+	case Copy, Move, Rename:
+		if o.Dst == f.path {
+			o.Result = op.Identical
+			return o
+		}
+		if err := fsys.MkdirAll(filepath.Dir(o.Dst), 0777); err != nil {
+			return fail(errors.Wrap(err, "couldn't create destination dir"))
+		}
+		var fr op.FileResult
+		if rule.Action == Copy {
+			fr, err = op.CopyFile(ctx, f.path, o.Dst, fileOpts)
+		} else {
+			fr, err = op.MoveFile(ctx, f.path, o.Dst, fileOpts)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		o.Dst, o.Result = fr.Dst, fr.Action
+		if rule.Action != Copy && fr.Action != op.Existing {
+			if err := tags.Move(fsys, f.path, fr.Dst); err != nil {
+				log.Warnf("Couldn't carry the tags of %s over: %s", f.path, err)
+			}
+		}
+	case Extract:
+		ar := unzip.Archive(ctx, f.path, unzip.Options{Dest: o.Dst, Limits: unzip.DefaultLimits, Collision: opts.Collision, Logger: opts.Logger, FS: opts.FS})
+		if ar.Err != nil {
+			return fail(ar.Err)
+		}
+		o.Result, o.Written, o.Replaced, o.Bytes = Extracted, ar.Written, ar.Replaced, ar.Bytes
+	case Delete:
+		if opts.Trash != "" {
+			return trash(ctx, f, o, opts)
+		}
+		if err := fsys.Remove(f.path); err != nil {
+			return fail(errors.Wrap(err, "couldn't delete file"))
+		}
+		if existing, err := tags.Get(fsys, f.path); err == nil && len(existing) > 0 {
+			tags.Remove(fsys, f.path, existing)
+		}
+		o.Result = Deleted
+		log.Infof("Deleted file: %s", f.path)
+	case Tag:
+		added, err := tags.Add(fsys, f.path, rule.Tags)
+		if err != nil {
+			return fail(err)
+		}
+		o.Result, o.Tags, o.Bytes = Tagged, added, 0
+		log.Infof("Tagged file: %s with %v", f.path, added)
+	}
+	return o
+}
+
+// trash moves f into opts.Trash, tags and all. A different file of the same
+// name already in the trash is kept and f gets a suffixed name.
+func trash(ctx context.Context, f *file, o Outcome, opts Options) Outcome {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	if err := fsys.MkdirAll(opts.Trash, 0777); err != nil {
+		o.Result, o.Err = op.Failed, errors.Wrap(err, "couldn't create trash")
+		return o
+	}
+	fileOpts := op.Options{Logger: opts.Logger, FS: opts.FS, Collision: op.CollisionRename}
+	fr, err := op.MoveFile(ctx, f.path, filepath.Join(opts.Trash, filepath.Base(f.path)), fileOpts)
+	if err != nil {
+		o.Result, o.Err = op.Failed, errors.Wrap(err, "couldn't move file into the trash")
+		return o
+	}
+	if err := tags.Move(fsys, f.path, fr.Dst); err != nil {
+		log.Warnf("Couldn't carry the tags of %s over: %s", f.path, err)
+	}
+	o.Dst, o.Result = fr.Dst, Deleted
+	log.Infof("Deleted file: %s, kept as %s", f.path, fr.Dst)
+	return o
+}
+
+// inside reports whether path is dir or below it.
+func inside(path, dir string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// target renders where rule sends path: its dest folder, below the rules'
+// destination when relative, and the file's name or its filename template.
+func target(ctx context.Context, rule *Rule, path string, seq int, opts Options) (string, error) {
+	fsys := vfs.Or(opts.FS)
+	dir, err := rule.Dest.ExecutePath(ctx, fsys, path, seq)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(dir) && opts.Dest != "" {
+		dir = filepath.Join(opts.Dest, dir)
+	}
+	if rule.Action == Extract {
+		return dir, nil
+	}
+
+	name := filepath.Base(path)
+	if rule.Filename != nil {
+		if name, err = rule.Filename.Execute(ctx, fsys, path, seq); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// journalEntry is one line of an apply journal.
+type journalEntry struct {
+	Rule     string    `json:"rule"`
+	Action   Action    `json:"action"`
+	Src      string    `json:"src"`
+	Dst      string    `json:"dst,omitempty"`
+	Result   op.Action `json:"result"`
+	Tags     []string  `json:"tags,omitempty"`
+	Written  []string  `json:"written,omitempty"`
+	Replaced []string  `json:"replaced,omitempty"`
+}
+
+type applyJournal struct {
+	f   vfs.File
+	enc *json.Encoder
+}
+
+func openJournal(fsys vfs.FS, path string) (*applyJournal, error) {
+	f, err := fsys.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't open apply journal")
+	}
+	return &applyJournal{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// record appends what o changed on disk, a nil journal records nothing.
+func (j *applyJournal) record(o Outcome) error {
+	if j == nil {
+		return nil
+	}
+	switch o.Result {
+	case op.Existing, Planned:
+		return nil
+	case op.Identical:
+		// Only a move removed anything.
+		if o.Action != Move && o.Action != Rename {
+			return nil
+		}
+	case Tagged:
+		if len(o.Tags) == 0 {
+			return nil
+		}
+	}
+	e := journalEntry{Rule: o.Rule, Action: o.Action, Src: o.Src, Dst: o.Dst, Result: o.Result, Tags: o.Tags, Written: o.Written, Replaced: o.Replaced}
+	if err := j.enc.Encode(e); err != nil {
+		return errors.Wrap(err, "couldn't write apply journal")
+	}
+	return errors.Wrap(j.f.Sync(), "couldn't sync apply journal")
+}
+
+func (j *applyJournal) close() error {
+	return j.f.Close()
+}
+
+// Undo reverts what a journal recorded, newest first, and removes the journal
+// once everything has been reverted. Copies and extracted files are removed,
+// moves and renames are moved back, deleted files come back out of the trash
+// and tags are taken off again. Files deleted without a trash and files
+// overwritten under op.CollisionOverwrite are gone for good, what replaced
+// them is kept and reported.
+func Undo(ctx context.Context, journalPath string, opts Options) error {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	f, err := fsys.Open(journalPath)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open apply journal")
+	}
+	defer f.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return errors.Wrap(err, "corrupt apply journal")
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "couldn't read apply journal")
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		e := entries[i]
+		if e.Result == op.Overwritten {
+			log.Warnf("Can't restore the file %s overwrote at %s", e.Src, e.Dst)
+		}
+
+		switch e.Action {
+		case Copy:
+			if e.Result == op.Overwritten {
+				// Removing the copy wouldn't bring the old file back.
+				continue
+			}
+			if err := removeIfExists(fsys, e.Dst); err != nil {
+				return err
+			}
+			log.Infof("Removed copy: %s", e.Dst)
+		case Move, Rename:
+			// An identical destination was already there, only the source
+			// went away.
+			if err := restore(ctx, e, e.Result == op.Identical, opts); err != nil {
+				return err
+			}
+		case Extract:
+			replaced := make(map[string]bool)
+			for _, path := range e.Replaced {
+				replaced[path] = true
+				log.Warnf("Can't restore the file %s overwrote at %s, keeping it", e.Src, path)
+			}
+			for j := len(e.Written) - 1; j >= 0; j-- {
+				if replaced[e.Written[j]] {
+					continue
+				}
+				if err := removeIfExists(fsys, e.Written[j]); err != nil {
+					return err
+				}
+			}
+			log.Infof("Removed %d file(s) extracted from: %s", len(e.Written)-len(replaced), e.Src)
+		case Delete:
+			if e.Dst == "" {
+				log.Warnf("Can't restore deleted file: %s", e.Src)
+				continue
+			}
+			// Identical files deleted earlier share the trashed file, it only
+			// leaves the trash with the earliest of them.
+			shared := false
+			for _, earlier := range entries[:i] {
+				if earlier.Action == Delete && earlier.Dst == e.Dst {
+					shared = true
+					break
+				}
+			}
+			if err := restore(ctx, e, shared, opts); err != nil {
+				return err
+			}
+		case Tag:
+			if err := tags.Remove(fsys, e.Src, e.Tags); err != nil {
+				return err
+			}
+			log.Infof("Untagged file: %s", e.Src)
+		}
+	}
+
+	// Everything has been reverted, a stale journal would only confuse the next run.
+	f.Close()
+	return errors.Wrap(fsys.Remove(journalPath), "couldn't remove apply journal")
+}
+
+// restore brings the file e moved to e.Dst back to e.Src, copying it when
+// keep is set.
+func restore(ctx context.Context, e journalEntry, keep bool, opts Options) error {
+	log := logging.Or(opts.Logger)
+	fsys := vfs.Or(opts.FS)
+	if _, err := fsys.Lstat(e.Dst); os.IsNotExist(err) {
+		// The move never happened or was already undone.
+		return nil
+	}
+	if _, err := fsys.Lstat(e.Src); err == nil {
+		return errors.Errorf("can't undo %s, original path is occupied", e.Dst)
+	}
+	if err := fsys.MkdirAll(filepath.Dir(e.Src), 0777); err != nil {
+		return errors.Wrap(err, "couldn't recreate original dir")
+	}
+	fileOpts := op.Options{Logger: opts.Logger, FS: opts.FS, Collision: op.CollisionSkip}
+	var err error
+	if keep {
+		_, err = op.CopyFile(ctx, e.Dst, e.Src, fileOpts)
+	} else {
+		_, err = op.MoveFile(ctx, e.Dst, e.Src, fileOpts)
+		if err == nil {
+			err = tags.Move(fsys, e.Dst, e.Src)
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "couldn't undo %s of %s", e.Action, e.Dst)
+	}
+	log.Infof("Restored file: %s -> %s", e.Dst, e.Src)
+	return nil
+}
+
+func removeIfExists(fsys vfs.FS, path string) error {
+	if err := fsys.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "couldn't remove %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package rules
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/deckarep/gorganize/file_management/vfs"
+)
+
+func parse(t *testing.T, doc string) *Rules {
+	t.Helper()
+	rs, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+// tree writes files, by path, into fsys.
+func tree(t *testing.T, fsys vfs.FS, files map[string]string) {
+	t.Helper()
+	for path, body := range files {
+		if err := fsys.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := vfs.WriteFile(fsys, path, []byte(body), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// files lists the regular files below root on fsys with their content.
+func files(t *testing.T, fsys vfs.FS, root string) map[string]string {
+	t.Helper()
+	found := make(map[string]string)
+	if _, err := fsys.Lstat(root); os.IsNotExist(err) {
+		return found
+	}
+	err := vfs.Walk(fsys, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		b, err := vfs.ReadFile(fsys, path)
+		found[path] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func assertFiles(t *testing.T, what string, got, want map[string]string) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func TestUndoRestoresDeletedFiles(t *testing.T) {
+	fsys := vfs.NewMem()
+	original := map[string]string{
+		"/src/keep.jpg":    "photo",
+		"/src/a.txt":       "a",
+		"/src/x/same.txt":  "same",
+		"/src/y/same.txt":  "same",
+		"/src/z/same.txt":  "different",
+		"/src/sub/old.txt": "old",
+	}
+	tree(t, fsys, original)
+	if err := fsys.MkdirAll("/j", 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := parse(t, "[[rule]]\nmatch = [\"*.txt\"]\naction = \"delete\"\n")
+	opts := Options{Journal: "/j/apply.journal", FS: fsys}
+	result, err := Apply(context.Background(), rs, []string{"/src"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := result.Stats(); s.Deleted != 5 || s.Failed != 0 {
+		t.Fatalf("got %+v, want 5 deleted", s)
+	}
+	if len(result.Done) != len(original) {
+		t.Errorf("done with %v, want every file", result.Done)
+	}
+	assertFiles(t, "after apply", files(t, fsys, "/src"), map[string]string{"/src/keep.jpg": "photo"})
+	if trashed := files(t, fsys, "/j/apply.journal.trash"); len(trashed) != 4 {
+		t.Errorf("trash holds %v, want 4 files", trashed)
+	}
+
+	if err := Undo(context.Background(), opts.Journal, opts); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, "after undo", files(t, fsys, "/src"), original)
+	assertFiles(t, "trash after undo", files(t, fsys, "/j/apply.journal.trash"), map[string]string{})
+	if _, err := fsys.Stat(opts.Journal); !os.IsNotExist(err) {
+		t.Errorf("journal wasn't removed: %v", err)
+	}
+}
+
+func TestApplySkipsTheTrash(t *testing.T) {
+	fsys := vfs.NewMem()
+	tree(t, fsys, map[string]string{
+		"/src/a.txt":             "a",
+		"/src/trash/earlier.txt": "earlier",
+	})
+
+	rs := parse(t, "[[rule]]\nmatch = [\"*.txt\"]\naction = \"delete\"\n")
+	opts := Options{Trash: "/src/trash", FS: fsys}
+	result, err := Apply(context.Background(), rs, []string{"/src"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 1 {
+		t.Errorf("went through %d files, want 1", result.Files)
+	}
+	assertFiles(t, "after apply", files(t, fsys, "/src"), map[string]string{
+		"/src/trash/a.txt":       "a",
+		"/src/trash/earlier.txt": "earlier",
+	})
+}
+
+func TestUndoKeepsFilesReplacedByExtract(t *testing.T) {
+	fsys := vfs.NewMem()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, e := range []struct{ name, body string }{{"a.txt", "from archive"}, {"b.txt", "b"}} {
+		if err := w.WriteHeader(&tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body))}); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.body))
+	}
+	w.Close()
+	tree(t, fsys, map[string]string{
+		"/src/pack.tar": buf.String(),
+		"/out/a.txt":    "original",
+	})
+
+	rs := parse(t, "[[rule]]\nmatch = [\"*.tar\"]\naction = \"extract\"\ndest = \"/out\"\n")
+	opts := Options{Journal: "/src/apply.journal", FS: fsys, Collision: op.CollisionOverwrite}
+	if _, err := Apply(context.Background(), rs, []string{"/src"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, "after apply", files(t, fsys, "/out"), map[string]string{
+		"/out/a.txt": "from archive",
+		"/out/b.txt": "b",
+	})
+
+	if err := Undo(context.Background(), opts.Journal, opts); err != nil {
+		t.Fatal(err)
+	}
+	// The original is gone, what replaced it is the only copy left.
+	assertFiles(t, "after undo", files(t, fsys, "/out"), map[string]string{"/out/a.txt": "from archive"})
+}
@@ -0,0 +1,424 @@
+// Package rules organizes files declaratively. A rules file is TOML listing
+// rules that are tried in order against every file below the sources:
+//
+//	sources = ["inbox"]
+//	dest = "library"
+//
+//	[[rule]]
+//	name = "nikon photos"
+//	match = ["image", "*.nef"]
+//	camera = "NIKON*"
+//	taken = "2016"
+//	min-size = "1MB"
+//	action = "move"
+//	dest = "photos/{date:2006}/{date:01}"
+//	filename = "{date:2006-01-02}_{seq:04}.{ext}"
+//
+//	[[rule]]
+//	name = "downloads"
+//	action = "extract"
+//	dest = "archives/{name}"
+//
+// The first matching rule decides what happens to a file. A rule setting
+// continue = true lets the following rules have a go at the file too, at
+// wherever it ended up.
+package rules
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/deckarep/gorganize/file_management/archive"
+	"github.com/deckarep/gorganize/file_management/meta"
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// Action is what a rule does with the files it matches.
+type Action string
+
+const (
+	// Copy copies the file into dest.
+	Copy Action = "copy"
+	// Move moves the file into dest.
+	Move Action = "move"
+	// Rename renames the file in place using filename.
+	Rename Action = "rename"
+	// Extract extracts the archive into dest. Only files named like archives,
+	// see archive.HasExt, match.
+	Extract Action = "extract"
+	// Delete moves the file into the trash, see Options.Trash.
+	Delete Action = "delete"
+	// Tag adds tags to the file, see package tags.
+	Tag Action = "tag"
+)
+
+// Rule pairs conditions with an action. Every condition set must hold for a
+// file to match.
+type Rule struct {
+	Name string
+	// Match selects files by category and glob, empty matches everything.
+	Match *op.Selection
+	// Exclude rejects files whose name matches any of the globs.
+	Exclude []string
+	// MinSize and MaxSize bound the file size in bytes, 0 is unbounded.
+	MinSize int64
+	MaxSize int64
+	// After and Before bound when the file was taken, falling back to its
+	// modification time. After is inclusive, Before is not, zero is unbounded.
+	After  time.Time
+	Before time.Time
+	// Camera is a glob matched against the camera model.
+	Camera string
+
+	Action Action
+	// Dest is the folder the file goes to. Relative paths are below the
+	// destination of the rules.
+	Dest *op.Template
+	// Filename renames the file, nil keeps its name.
+	Filename *op.Template
+	Tags     []string
+	// Continue tries the following rules after this one matched.
+	Continue bool
+}
+
+func (r *Rule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return string(r.Action)
+}
+
+// needsMeta reports whether matching reads the file's metadata.
+func (r *Rule) needsMeta() bool {
+	return !r.After.IsZero() || !r.Before.IsZero() || r.Camera != ""
+}
+
+// Rules is a parsed rules file.
+type Rules struct {
+	// Sources are the folders walked when none are given.
+	Sources []string
+	// Dest is where relative destinations point, it defaults to the current
+	// directory.
+	Dest  string
+	Rules []*Rule
+}
+
+// Dirs returns the folders the rules write below, the fixed part of every
+// rule destination. Relative ones are below dest, which defaults to the
+// destination of the rules.
+func (rs *Rules) Dirs(dest string) []string {
+	if dest == "" {
+		dest = rs.Dest
+	}
+	var dirs []string
+	for _, rule := range rs.Rules {
+		if rule.Dest == nil {
+			continue
+		}
+		dir := rule.Dest.Dir()
+		if dir == "" {
+			// Below dest itself, which only counts when set.
+			dir = dest
+		} else if !filepath.IsAbs(dir) && dest != "" {
+			dir = filepath.Join(dest, dir)
+		}
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// Load reads the rules file at path. Relative sources and dest in it are
+// relative to the file, so it works from any directory.
+func Load(fsys vfs.FS, path string) (*Rules, error) {
+	f, err := vfs.Or(fsys).Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't open rules")
+	}
+	defer f.Close()
+
+	rs, err := Parse(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rules %s", path)
+	}
+	dir := filepath.Dir(path)
+	for i, source := range rs.Sources {
+		rs.Sources[i] = relativeTo(dir, source)
+	}
+	if rs.Dest != "" {
+		rs.Dest = relativeTo(dir, rs.Dest)
+	}
+	return rs, nil
+}
+
+func relativeTo(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Parse reads a rules file.
+func Parse(r io.Reader) (*Rules, error) {
+	var doc map[string]interface{}
+	if _, err := toml.DecodeReader(r, &doc); err != nil {
+		return nil, err
+	}
+
+	rs := &Rules{}
+	for key, value := range doc {
+		var ok bool
+		switch key {
+		case "sources":
+			rs.Sources, ok = stringList(value)
+		case "dest":
+			rs.Dest, ok = value.(string)
+		case "rule":
+			var tables []map[string]interface{}
+			if tables, ok = value.([]map[string]interface{}); !ok {
+				return nil, errors.New("rule must be an array of tables, written [[rule]]")
+			}
+			for i, table := range tables {
+				rule, err := parseRule(table)
+				if err != nil {
+					return nil, errors.Wrapf(err, "rule %d", i+1)
+				}
+				rs.Rules = append(rs.Rules, rule)
+			}
+		default:
+			return nil, errors.Errorf("unknown key: %s", key)
+		}
+		if !ok {
+			return nil, errors.Errorf("%s has the wrong type", key)
+		}
+	}
+	if len(rs.Rules) == 0 {
+		return nil, errors.New("no [[rule]] defined")
+	}
+	return rs, nil
+}
+
+func parseRule(table map[string]interface{}) (*Rule, error) {
+	r := &Rule{}
+	var dest, filename string
+	for key, value := range table {
+		var ok bool
+		var err error
+		switch key {
+		case "name":
+			r.Name, ok = value.(string)
+		case "match":
+			var items []string
+			if items, ok = stringList(value); ok {
+				r.Match, err = op.ParseSelection(items)
+			}
+		case "exclude":
+			if r.Exclude, ok = stringList(value); ok {
+				err = op.Filter{Exclude: r.Exclude}.Validate()
+			}
+		case "min-size":
+			r.MinSize, ok, err = size(value)
+		case "max-size":
+			r.MaxSize, ok, err = size(value)
+		case "after":
+			r.After, _, ok, err = date(value)
+		case "before":
+			r.Before, _, ok, err = date(value)
+		case "taken":
+			r.After, r.Before, ok, err = date(value)
+		case "camera":
+			if r.Camera, ok = value.(string); ok {
+				_, err = filepath.Match(r.Camera, "")
+			}
+		case "action":
+			var name string
+			name, ok = value.(string)
+			r.Action = Action(name)
+		case "dest":
+			dest, ok = value.(string)
+		case "filename":
+			filename, ok = value.(string)
+		case "tags":
+			r.Tags, ok = stringList(value)
+		case "continue":
+			r.Continue, ok = value.(bool)
+		default:
+			return nil, errors.Errorf("unknown key: %s", key)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, key)
+		}
+		if !ok {
+			return nil, errors.Errorf("%s has the wrong type", key)
+		}
+	}
+	if r.Name != "" {
+		// Rules are easier to find by name than by number.
+		return r, errors.Wrap(r.check(dest, filename), r.Name)
+	}
+	return r, r.check(dest, filename)
+}
+
+// check validates the action and parses the templates it uses.
+func (r *Rule) check(dest, filename string) error {
+	var wantDest, wantFilename, wantTags bool
+	switch r.Action {
+	case Copy, Move:
+		wantDest = true
+	case Rename:
+		wantFilename = true
+	case Extract:
+		wantDest = true
+		if filename != "" {
+			return errors.New("extract takes no filename")
+		}
+	case Delete:
+	case Tag:
+		wantTags = true
+	case "":
+		return errors.New("no action")
+	default:
+		return errors.Errorf("unknown action: %s, expected copy, move, rename, extract, delete or tag", r.Action)
+	}
+
+	switch {
+	case wantDest && dest == "":
+		return errors.Errorf("%s needs a dest", r.Action)
+	case !wantDest && dest != "":
+		return errors.Errorf("%s takes no dest", r.Action)
+	case wantFilename && filename == "":
+		return errors.Errorf("%s needs a filename", r.Action)
+	case !wantDest && !wantFilename && filename != "":
+		return errors.Errorf("%s takes no filename", r.Action)
+	case wantTags && len(r.Tags) == 0:
+		return errors.Errorf("%s needs tags", r.Action)
+	case !wantTags && len(r.Tags) > 0:
+		return errors.Errorf("%s takes no tags", r.Action)
+	}
+
+	var err error
+	if dest != "" {
+		if r.Dest, err = op.ParseTemplate(dest); err != nil {
+			return errors.Wrap(err, "dest")
+		}
+	}
+	if filename != "" {
+		if r.Filename, err = op.ParseTemplate(filename); err != nil {
+			return errors.Wrap(err, "filename")
+		}
+	}
+	return nil
+}
+
+func stringList(v interface{}) ([]string, bool) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		list = append(list, s)
+	}
+	return list, true
+}
+
+// size reads a size given in bytes or as a string such as "10MB".
+func size(v interface{}) (int64, bool, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, true, nil
+	case string:
+		n, err := op.ParseSize(v)
+		return n, true, err
+	}
+	return 0, false, nil
+}
+
+// date reads a date given as a string, or a bare year.
+func date(v interface{}) (time.Time, time.Time, bool, error) {
+	var text string
+	switch v := v.(type) {
+	case int64:
+		text = fmt.Sprint(v)
+	case string:
+		text = v
+	default:
+		return time.Time{}, time.Time{}, false, nil
+	}
+	start, end, err := op.ParseDate(text)
+	return start, end, true, err
+}
+
+// file is a file being run through the rules.
+type file struct {
+	path string
+	size int64
+	info *meta.Info
+}
+
+// meta reads the file's metadata once.
+func (f *file) meta(fsys vfs.FS) (meta.Info, error) {
+	if f.info == nil {
+		info, err := meta.Read(fsys, f.path)
+		if err != nil {
+			return meta.Info{}, err
+		}
+		f.info = &info
+	}
+	return *f.info, nil
+}
+
+// matches reports whether every condition of r holds for f.
+func (r *Rule) matches(fsys vfs.FS, f *file) (bool, error) {
+	name := filepath.Base(f.path)
+	switch {
+	case !r.Match.Match(f.path):
+		return false, nil
+	case !(op.Filter{Exclude: r.Exclude}).Match(name):
+		return false, nil
+	case r.MinSize > 0 && f.size < r.MinSize:
+		return false, nil
+	case r.MaxSize > 0 && f.size > r.MaxSize:
+		return false, nil
+	}
+
+	if r.needsMeta() {
+		info, err := f.meta(fsys)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case !r.After.IsZero() && info.Taken.Before(r.After):
+			return false, nil
+		case !r.Before.IsZero() && !info.Taken.Before(r.Before):
+			return false, nil
+		case r.Camera != "":
+			if ok, _ := filepath.Match(strings.ToLower(r.Camera), strings.ToLower(info.Camera)); !ok {
+				return false, nil
+			}
+		}
+	}
+
+	if r.Action == Extract {
+		if !archive.HasExt(f.path) {
+			return false, nil
+		}
+		format, err := archive.Detect(fsys, f.path)
+		if err != nil {
+			return false, err
+		}
+		return format != archive.Unknown, nil
+	}
+	return true, nil
+}
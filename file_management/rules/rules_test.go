@@ -0,0 +1,43 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDirs(t *testing.T) {
+	rs := parse(t, `dest = "/sorted"
+
+[[rule]]
+match = ["image"]
+action = "move"
+dest = "/photos/{date:2006}/{date:01}"
+
+[[rule]]
+match = ["video"]
+action = "copy"
+dest = "videos/by-{date:2006}"
+
+[[rule]]
+match = ["*.zip"]
+action = "extract"
+dest = "archives"
+
+[[rule]]
+match = ["*.txt"]
+action = "move"
+dest = "{date:2006}"
+
+[[rule]]
+match = ["*.tmp"]
+action = "delete"
+`)
+	want := []string{"/photos", "/sorted/videos", "/sorted/archives", "/sorted"}
+	if got := rs.Dirs(""); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	want = []string{"/photos", "/elsewhere/videos", "/elsewhere/archives", "/elsewhere"}
+	if got := rs.Dirs("/elsewhere"); !reflect.DeepEqual(got, want) {
+		t.Errorf("with a dest got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,91 @@
+package snapshot
+
+import (
+	"io"
+)
+
+// Chunk boundaries are content defined: a gear rolling hash is computed over
+// the data and a chunk ends wherever the low bits of the hash are all zero.
+// Inserting or removing bytes in a large file therefore only changes the
+// chunks around the edit, the rest still hash to objects already stored.
+const (
+	minChunkSize = 512 << 10
+	maxChunkSize = 8 << 20
+	// chunkMask gives an average chunk size of about 1MiB past the minimum.
+	chunkMask = 1<<20 - 1
+)
+
+var gearTable = func() (table [256]uint64) {
+	// splitmix64 with a fixed seed, the table must never change or previously
+	// stored files would chunk differently.
+	seed := uint64(0x676f7267616e697a)
+	for i := range table {
+		seed += 0x9E3779B97F4A7C15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+type chunker struct {
+	r   io.Reader
+	buf []byte
+	n   int
+	eof bool
+}
+
+func newChunker() *chunker {
+	return &chunker{buf: make([]byte, maxChunkSize)}
+}
+
+// reset points the chunker at a new input, reusing its buffer.
+func (c *chunker) reset(r io.Reader) {
+	c.r, c.n, c.eof = r, 0, false
+}
+
+// Next returns the next chunk or io.EOF once the input is exhausted.
+func (c *chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.n == 0 {
+		return nil, io.EOF
+	}
+
+	cut := boundary(c.buf[:c.n])
+	chunk := make([]byte, cut)
+	copy(chunk, c.buf[:cut])
+
+	c.n = copy(c.buf, c.buf[cut:c.n])
+	return chunk, nil
+}
+
+func (c *chunker) fill() error {
+	for !c.eof && c.n < len(c.buf) {
+		read, err := c.r.Read(c.buf[c.n:])
+		c.n += read
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func boundary(data []byte) int {
+	if len(data) <= minChunkSize {
+		return len(data)
+	}
+
+	var hash uint64
+	for i := minChunkSize; i < len(data); i++ {
+		hash = hash<<1 + gearTable[data[i]]
+		if hash&chunkMask == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
@@ -0,0 +1,107 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+)
+
+// chunks splits data and returns the sha256 of every chunk.
+func chunks(t *testing.T, data []byte) [][32]byte {
+	t.Helper()
+	c := newChunker()
+	c.reset(bytes.NewReader(data))
+	var sums [][32]byte
+	var total int
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk) > maxChunkSize {
+			t.Errorf("chunk of %d bytes is over the maximum", len(chunk))
+		}
+		total += len(chunk)
+		sums = append(sums, sha256.Sum256(chunk))
+	}
+	if total != len(data) {
+		t.Fatalf("chunks hold %d bytes, want %d", total, len(data))
+	}
+	return sums
+}
+
+func TestChunkerReusesChunksAroundAnInsert(t *testing.T) {
+	data := make([]byte, 32<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	edited := append(append(append([]byte{}, data[:len(data)/2]...), "inserted in the middle"...), data[len(data)/2:]...)
+
+	before, after := chunks(t, data), chunks(t, edited)
+	if len(before) < 8 {
+		t.Fatalf("only %d chunks, the test needs more", len(before))
+	}
+	known := make(map[[32]byte]bool)
+	for _, sum := range before {
+		known[sum] = true
+	}
+	var fresh int
+	for _, sum := range after {
+		if !known[sum] {
+			fresh++
+		}
+	}
+	// Only the chunk holding the edit, and at most the one after it should
+	// the boundary have moved, is new.
+	if fresh == 0 || fresh > 2 {
+		t.Errorf("%d of %d chunks changed, want 1 or 2", fresh, len(after))
+	}
+	if !known[after[0]] || !known[after[len(after)-1]] {
+		t.Error("chunks far from the edit changed")
+	}
+}
+
+func TestStatsRatio(t *testing.T) {
+	fsys := vfs.NewMem()
+	data := make([]byte, 16<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+	tree(t, fsys, map[string]string{"/in/big.bin": string(data)})
+	repo, err := Open(fsys, "/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	first, err := repo.Create(ctx, []string{"/in"}, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited := append(append(append([]byte{}, data[:len(data)/2]...), "edit"...), data[len(data)/2:]...)
+	tree(t, fsys, map[string]string{"/in/big.bin": string(edited)})
+	second, err := repo.Create(ctx, []string{"/in"}, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Stored >= first.Stored/2 {
+		t.Errorf("second snapshot stored %d of %d bytes", second.Stored, len(edited))
+	}
+
+	stats, err := repo.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logical := int64(len(data) + len(edited))
+	stored := first.Stored + second.Stored
+	if stats.LogicalBytes != logical || stats.StoredBytes != stored {
+		t.Errorf("got %d logical and %d stored bytes, want %d and %d", stats.LogicalBytes, stats.StoredBytes, logical, stored)
+	}
+	if want := float64(logical) / float64(stored); stats.Ratio() != want || want < 1.5 {
+		t.Errorf("ratio is %.2f, want %.2f", stats.Ratio(), want)
+	}
+}
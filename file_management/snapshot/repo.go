@@ -0,0 +1,184 @@
+package snapshot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// Repo is a local content addressable store. File contents are split into
+// content defined chunks stored under objects/ named by their sha256,
+// snapshot manifests live under snapshots/.
+// sha256 is used instead of md5 because a collision here would silently
+// restore the wrong content.
+type Repo struct {
+	fsys vfs.FS
+	path string
+}
+
+const (
+	objectsDir   = "objects"
+	snapshotsDir = "snapshots"
+	tmpDir       = "tmp"
+)
+
+// Open opens the repository at path on fsys, creating its layout when it
+// doesn't exist yet. Snapshotted and restored folders are on fsys too.
+func Open(fsys vfs.FS, path string) (*Repo, error) {
+	fsys = vfs.Or(fsys)
+	for _, dir := range []string{objectsDir, snapshotsDir, tmpDir} {
+		if err := fsys.MkdirAll(filepath.Join(path, dir), 0777); err != nil {
+			return nil, errors.Wrapf(err, "couldn't initialize repo: %s", path)
+		}
+	}
+	return &Repo{fsys: fsys, path: path}, nil
+}
+
+func (r *Repo) objectPath(hash string) string {
+	return filepath.Join(r.path, objectsDir, hash[:2], hash[2:])
+}
+
+func (r *Repo) hasObject(hash string) bool {
+	_, err := r.fsys.Stat(r.objectPath(hash))
+	return err == nil
+}
+
+// putChunk stores data unless an identical chunk already exists. It returns
+// the chunk hash and how many bytes were actually written.
+func (r *Repo) putChunk(data []byte) (hash string, stored int64, err error) {
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])
+	if r.hasObject(hash) {
+		return hash, 0, nil
+	}
+
+	// Named by process too, so two runs storing the same chunk don't write
+	// over each other's temp file.
+	tmp := filepath.Join(r.path, tmpDir, fmt.Sprintf("object-%s-%d", hash, os.Getpid()))
+	defer r.fsys.Remove(tmp)
+	if err := vfs.WriteFile(r.fsys, tmp, data, 0666); err != nil {
+		return "", 0, errors.Wrap(err, "couldn't write temp object")
+	}
+
+	dest := r.objectPath(hash)
+	if err := r.fsys.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return "", 0, errors.Wrap(err, "couldn't create object folder")
+	}
+	if err := r.fsys.Rename(tmp, dest); err != nil {
+		return "", 0, errors.Wrap(err, "couldn't store object")
+	}
+	return hash, int64(len(data)), nil
+}
+
+func (r *Repo) openObject(hash string) (io.ReadCloser, error) {
+	f, err := r.fsys.Open(r.objectPath(hash))
+	if err != nil {
+		return nil, errors.Wrapf(err, "missing object: %s", hash)
+	}
+	return f, nil
+}
+
+func (r *Repo) saveSnapshot(s *Snapshot) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode snapshot manifest")
+	}
+
+	tmp := filepath.Join(r.path, tmpDir, s.ID+".json")
+	if err := vfs.WriteFile(r.fsys, tmp, b, 0666); err != nil {
+		return errors.Wrap(err, "couldn't write snapshot manifest")
+	}
+	return errors.Wrap(r.fsys.Rename(tmp, filepath.Join(r.path, snapshotsDir, s.ID+".json")),
+		"couldn't store snapshot manifest")
+}
+
+// Load reads the manifest of the snapshot with the given id. A unique prefix
+// of the id is accepted.
+func (r *Repo) Load(id string) (*Snapshot, error) {
+	ids, err := r.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	var match string
+	for _, candidate := range ids {
+		if candidate == id {
+			return r.load(id)
+		}
+		if strings.HasPrefix(candidate, id) {
+			if match != "" {
+				return nil, errors.Errorf("snapshot id is ambiguous: %s", id)
+			}
+			match = candidate
+		}
+	}
+	if match == "" {
+		return nil, errors.Errorf("no such snapshot: %s", id)
+	}
+	return r.load(match)
+}
+
+func (r *Repo) load(id string) (*Snapshot, error) {
+	b, err := vfs.ReadFile(r.fsys, filepath.Join(r.path, snapshotsDir, id+".json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read snapshot manifest")
+	}
+
+	s := &Snapshot{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, errors.Wrapf(err, "corrupt snapshot manifest: %s", id)
+	}
+	return s, nil
+}
+
+// List returns every snapshot in the repository, oldest first. It stops
+// between manifests once ctx is done.
+func (r *Repo) List(ctx context.Context) ([]*Snapshot, error) {
+	ids, err := r.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*Snapshot, 0, len(ids))
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		s, err := r.load(id)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	// Ids only have second resolution, the manifest time settles ties.
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+func (r *Repo) ids() ([]string, error) {
+	infos, err := r.fsys.ReadDir(filepath.Join(r.path, snapshotsDir))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't list snapshots")
+	}
+
+	var ids []string
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), ".json") {
+			ids = append(ids, strings.TrimSuffix(info.Name(), ".json"))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,311 @@
+package snapshot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/logging"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// Snapshot is the manifest of a tree at a point in time.
+type Snapshot struct {
+	ID    string    `json:"id"`
+	Time  time.Time `json:"time"`
+	Roots []string  `json:"roots"`
+	Files []Entry   `json:"files"`
+	// Stored is how many new bytes this snapshot added to the repository.
+	Stored int64 `json:"stored"`
+}
+
+// Entry describes a single file of a snapshot. Path is slash separated and
+// prefixed with the base name of the root it was found under. Hash is the
+// sha256 of the whole file, Chunks lists the objects it is made of. Entries
+// written before chunking was introduced have no Chunks and are stored as a
+// single object named by Hash. Empty files have no objects at all.
+type Entry struct {
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+	Hash    string      `json:"hash"`
+	Chunks  []string    `json:"chunks,omitempty"`
+}
+
+func (e Entry) objects() []string {
+	if e.Size == 0 {
+		return nil
+	}
+	if len(e.Chunks) == 0 {
+		return []string{e.Hash}
+	}
+	return e.Chunks
+}
+
+// Size is the total logical size of all files in the snapshot.
+func (s *Snapshot) Size() int64 {
+	var total int64
+	for _, e := range s.Files {
+		total += e.Size
+	}
+	return total
+}
+
+// CreateOptions controls Repo.Create.
+type CreateOptions struct {
+	Logger logging.Logger
+}
+
+// Create stores every file below dirs in the repository and records a new
+// snapshot of them. Nothing is recorded when ctx is done before the end, the
+// chunks already stored are simply reused by the next run.
+func (r *Repo) Create(ctx context.Context, dirs []string, opts CreateOptions) (*Snapshot, error) {
+	log := logging.Or(opts.Logger)
+	s := &Snapshot{Time: time.Now()}
+	c := newChunker()
+
+	for _, dir := range dirs {
+		root, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't resolve: %s", dir)
+		}
+		s.Roots = append(s.Roots, root)
+
+		err = vfs.Walk(r.fsys, root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(filepath.Dir(root), path)
+			if err != nil {
+				return err
+			}
+
+			entry, stored, err := r.storeFile(c, path, info)
+			if err != nil {
+				return err
+			}
+			entry.Path = filepath.ToSlash(rel)
+			s.Files = append(s.Files, entry)
+			s.Stored += stored
+
+			log.Debugf("Stored file: %s (%d new bytes)", path, stored)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't snapshot: %s", dir)
+		}
+	}
+
+	s.ID = snapshotID(s)
+	if err := r.saveSnapshot(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *Repo) storeFile(c *chunker, path string, info os.FileInfo) (Entry, int64, error) {
+	f, err := r.fsys.Open(path)
+	if err != nil {
+		return Entry{}, 0, errors.Wrap(err, "couldn't open file for snapshot")
+	}
+	defer f.Close()
+
+	entry := Entry{
+		Mode:    info.Mode().Perm(),
+		ModTime: info.ModTime(),
+	}
+
+	var stored int64
+	h := sha256.New()
+	c.reset(io.TeeReader(f, h))
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Entry{}, 0, errors.Wrapf(err, "couldn't read: %s", path)
+		}
+
+		hash, n, err := r.putChunk(chunk)
+		if err != nil {
+			return Entry{}, 0, errors.Wrapf(err, "couldn't store: %s", path)
+		}
+		entry.Chunks = append(entry.Chunks, hash)
+		entry.Size += int64(len(chunk))
+		stored += n
+	}
+
+	entry.Hash = hex.EncodeToString(h.Sum(nil))
+	return entry, stored, nil
+}
+
+// snapshotID is a sortable timestamp followed by a short digest of the
+// manifest so two snapshots taken in the same second don't clash.
+func snapshotID(s *Snapshot) string {
+	h := sha256.New()
+	fmt.Fprintln(h, s.Time.UnixNano())
+	for _, e := range s.Files {
+		fmt.Fprintln(h, e.Path, e.Hash)
+	}
+	return s.Time.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// RestoreOptions controls Repo.Restore.
+type RestoreOptions struct {
+	// Overwrite replaces existing files, otherwise they are skipped.
+	Overwrite bool
+	Logger    logging.Logger
+}
+
+// Restore writes the files of snapshot id below target, restoring their mode
+// and modification time.
+func (r *Repo) Restore(ctx context.Context, id, target string, opts RestoreOptions) (*Snapshot, error) {
+	log := logging.Or(opts.Logger)
+	s, err := r.Load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Manifests are plain JSON, check every path before writing anything.
+	dests := make([]string, len(s.Files))
+	for i, e := range s.Files {
+		if dests[i], err = restorePath(target, e.Path); err != nil {
+			return s, err
+		}
+	}
+
+	for i, e := range s.Files {
+		if err := ctx.Err(); err != nil {
+			return s, err
+		}
+		dest := dests[i]
+		if _, err := r.fsys.Lstat(dest); err == nil && !opts.Overwrite {
+			log.Infof("File exists, skipping: %s", dest)
+			continue
+		}
+		if err := r.restoreFile(e, dest); err != nil {
+			return s, errors.Wrapf(err, "couldn't restore: %s", e.Path)
+		}
+		log.Infof("Restored file: %s", dest)
+	}
+	return s, nil
+}
+
+// restorePath joins the slash separated manifest path p onto target,
+// rejecting absolute paths and paths that climb out of target.
+func restorePath(target, p string) (string, error) {
+	if p == "" || strings.ContainsRune(p, 0) || path.IsAbs(p) || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return "", errors.Errorf("unsafe path in snapshot: %q", p)
+	}
+	dest := filepath.Join(target, filepath.FromSlash(p))
+	rel, err := filepath.Rel(target, dest)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("unsafe path in snapshot: %q", p)
+	}
+	return dest, nil
+}
+
+func (r *Repo) restoreFile(e Entry, dest string) error {
+	if err := r.fsys.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return errors.Wrap(err, "couldn't create parent folder")
+	}
+
+	tmp := dest + ".gorganize-tmp"
+	out, err := r.fsys.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, e.Mode)
+	if err != nil {
+		return errors.Wrap(err, "couldn't create restored file")
+	}
+
+	h := sha256.New()
+	err = r.copyObjects(io.MultiWriter(out, h), e.objects())
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != e.Hash {
+		err = errors.Errorf("content of %s doesn't match its hash", e.Path)
+	}
+	if err != nil {
+		r.fsys.Remove(tmp)
+		return errors.Wrap(err, "couldn't write restored file")
+	}
+
+	r.fsys.Chtimes(tmp, e.ModTime, e.ModTime)
+	return errors.Wrap(r.fsys.Rename(tmp, dest), "couldn't move restored file into place")
+}
+
+func (r *Repo) copyObjects(w io.Writer, hashes []string) error {
+	for _, hash := range hashes {
+		obj, err := r.openObject(hash)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, obj)
+		obj.Close()
+		if err != nil {
+			return errors.Wrapf(err, "couldn't read object: %s", hash)
+		}
+	}
+	return nil
+}
+
+// Change is a single difference between two snapshots.
+type Change struct {
+	Kind string // "added", "removed" or "modified"
+	Path string
+}
+
+// Diff compares snapshot a against snapshot b. It only reads their manifests,
+// ctx is checked between them.
+func (r *Repo) Diff(ctx context.Context, a, b string) ([]Change, error) {
+	from, err := r.Load(a)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	to, err := r.Load(b)
+	if err != nil {
+		return nil, err
+	}
+
+	before := make(map[string]Entry, len(from.Files))
+	for _, e := range from.Files {
+		before[e.Path] = e
+	}
+
+	var changes []Change
+	for _, e := range to.Files {
+		old, ok := before[e.Path]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: "added", Path: e.Path})
+		case old.Hash != e.Hash:
+			changes = append(changes, Change{Kind: "modified", Path: e.Path})
+		}
+		delete(before, e.Path)
+	}
+	for _, e := range from.Files {
+		if _, ok := before[e.Path]; ok {
+			changes = append(changes, Change{Kind: "removed", Path: e.Path})
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,156 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+)
+
+// tree writes files, by path, into fsys.
+func tree(t *testing.T, fsys vfs.FS, files map[string]string) {
+	t.Helper()
+	for path, body := range files {
+		if err := fsys.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := vfs.WriteFile(fsys, path, []byte(body), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// files lists the regular files below root on fsys with their content.
+func files(t *testing.T, fsys vfs.FS, root string) map[string]string {
+	t.Helper()
+	found := make(map[string]string)
+	err := vfs.Walk(fsys, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		b, err := vfs.ReadFile(fsys, path)
+		found[path] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	fsys := vfs.NewMem()
+	tree(t, fsys, map[string]string{
+		"/photos/a.jpg":      "a",
+		"/photos/2017/b.jpg": "b",
+		"/photos/copy.jpg":   "a",
+		"/photos/empty.txt":  "",
+	})
+	repo, err := Open(fsys, "/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	first, err := repo.Create(ctx, []string{"/photos"}, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Files) != 4 {
+		t.Fatalf("snapshot holds %v, want 4 files", first.Files)
+	}
+	// a.jpg and copy.jpg share their only chunk.
+	if first.Stored != 2 {
+		t.Errorf("stored %d bytes, want 2", first.Stored)
+	}
+
+	tree(t, fsys, map[string]string{"/photos/a.jpg": "changed", "/photos/new.jpg": "b"})
+	if err := fsys.Remove("/photos/empty.txt"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := repo.Create(ctx, []string{"/photos"}, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Stored != int64(len("changed")) {
+		t.Errorf("second snapshot stored %d bytes, want only the changed file", second.Stored)
+	}
+
+	changes, err := repo.Diff(ctx, first.ID, second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Kind: "modified", Path: "photos/a.jpg"},
+		{Kind: "added", Path: "photos/new.jpg"},
+		{Kind: "removed", Path: "photos/empty.txt"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("diff is %v, want %v", changes, want)
+	}
+
+	if _, err := repo.Restore(ctx, first.ID[:len(first.ID)-2], "/restored", RestoreOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	restored := files(t, fsys, "/restored")
+	if !reflect.DeepEqual(restored, map[string]string{
+		"/restored/photos/a.jpg":      "a",
+		"/restored/photos/2017/b.jpg": "b",
+		"/restored/photos/copy.jpg":   "a",
+		"/restored/photos/empty.txt":  "",
+	}) {
+		t.Errorf("restored %v", restored)
+	}
+
+	stats, err := repo.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Snapshots != 2 || stats.Files != 8 || stats.Chunks != 3 || stats.LogicalBytes != 13 || stats.StoredBytes != 9 {
+		t.Errorf("got %+v", stats)
+	}
+}
+
+func TestRestoreRejectsUnsafePaths(t *testing.T) {
+	for _, path := range []string{"../evil.txt", "photos/../../evil.txt", "/tmp/evil.txt", "", "."} {
+		fsys := vfs.NewMem()
+		tree(t, fsys, map[string]string{"/photos/a.jpg": "a"})
+		repo, err := Open(fsys, "/repo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := repo.Create(context.Background(), []string{"/photos"}, CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Add a hostile entry to the manifest after the good one.
+		evil := s.Files[0]
+		evil.Path = path
+		s.Files = append(s.Files, evil)
+		b, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vfs.WriteFile(fsys, filepath.Join("/repo", snapshotsDir, s.ID+".json"), b, 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.MkdirAll("/restore/target", 0777); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Restore(context.Background(), s.ID, "/restore/target", RestoreOptions{}); err == nil {
+			t.Errorf("%q was restored", path)
+		}
+		if written := files(t, fsys, "/restore"); len(written) != 0 {
+			t.Errorf("%q: restore wrote %v", path, written)
+		}
+		if _, err := fsys.Stat("/tmp/evil.txt"); !os.IsNotExist(err) {
+			t.Errorf("%q: evil.txt was written: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// Stats describes how much space a repository actually saves.
+type Stats struct {
+	Snapshots int
+	Files     int
+	// LogicalBytes is the size of every file of every snapshot, what a plain
+	// copy of each snapshot would take.
+	LogicalBytes int64
+	Chunks       int
+	// StoredBytes is what the chunk objects take on disk.
+	StoredBytes int64
+}
+
+// Ratio is the dedupe ratio, logical bytes per stored byte.
+func (s Stats) Ratio() float64 {
+	if s.StoredBytes == 0 {
+		return 0
+	}
+	return float64(s.LogicalBytes) / float64(s.StoredBytes)
+}
+
+// Stats walks the repository and computes its dedupe statistics, stopping
+// once ctx is done.
+func (r *Repo) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+
+	snapshots, err := r.List(ctx)
+	if err != nil {
+		return stats, err
+	}
+	stats.Snapshots = len(snapshots)
+	for _, s := range snapshots {
+		stats.Files += len(s.Files)
+		stats.LogicalBytes += s.Size()
+	}
+
+	err = vfs.Walk(r.fsys, filepath.Join(r.path, objectsDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			stats.Chunks++
+			stats.StoredBytes += info.Size()
+		}
+		return nil
+	})
+	return stats, errors.Wrap(err, "couldn't walk repo objects")
+}
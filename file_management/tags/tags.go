@@ -0,0 +1,145 @@
+// Package tags keeps free form labels on files. The tags of a directory's
+// files live in a sidecar file inside it, so they travel with the directory
+// and need nothing but the filesystem.
+package tags
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// FileName is the name of the sidecar file holding a directory's tags.
+const FileName = ".gorganize-tags"
+
+// Dir returns the tags of the files in dir, keyed by base name. A directory
+// without a sidecar has no tags.
+func Dir(fsys vfs.FS, dir string) (map[string][]string, error) {
+	f, err := fsys.Open(filepath.Join(dir, FileName))
+	if os.IsNotExist(err) {
+		return map[string][]string{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't open tags")
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read tags")
+	}
+	all := make(map[string][]string)
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, errors.Wrapf(err, "corrupt tags in %s", dir)
+	}
+	return all, nil
+}
+
+// Get returns the tags of the file at path, sorted.
+func Get(fsys vfs.FS, path string) ([]string, error) {
+	all, err := Dir(fsys, filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	return all[filepath.Base(path)], nil
+}
+
+// Add tags the file at path and returns the tags it didn't already have.
+func Add(fsys vfs.FS, path string, tags []string) ([]string, error) {
+	var added []string
+	err := update(fsys, filepath.Dir(path), func(all map[string][]string) {
+		name := filepath.Base(path)
+		have := make(map[string]bool)
+		for _, tag := range all[name] {
+			have[tag] = true
+		}
+		for _, tag := range tags {
+			if tag != "" && !have[tag] {
+				have[tag] = true
+				added = append(added, tag)
+				all[name] = append(all[name], tag)
+			}
+		}
+	})
+	return added, err
+}
+
+// Remove takes tags off the file at path.
+func Remove(fsys vfs.FS, path string, tags []string) error {
+	return update(fsys, filepath.Dir(path), func(all map[string][]string) {
+		name := filepath.Base(path)
+		drop := make(map[string]bool)
+		for _, tag := range tags {
+			drop[tag] = true
+		}
+		var kept []string
+		for _, tag := range all[name] {
+			if !drop[tag] {
+				kept = append(kept, tag)
+			}
+		}
+		all[name] = kept
+	})
+}
+
+// Move carries the tags of a file that was moved from one path to another.
+func Move(fsys vfs.FS, from, to string) error {
+	tags, err := Get(fsys, from)
+	if err != nil || len(tags) == 0 {
+		return err
+	}
+	if _, err := Add(fsys, to, tags); err != nil {
+		return err
+	}
+	return Remove(fsys, from, tags)
+}
+
+// update rewrites the sidecar of dir with fn applied. Files left without tags
+// are dropped and an empty sidecar is removed.
+func update(fsys vfs.FS, dir string, fn func(map[string][]string)) error {
+	all, err := Dir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	fn(all)
+
+	for name, tags := range all {
+		if len(tags) == 0 {
+			delete(all, name)
+			continue
+		}
+		sort.Strings(tags)
+	}
+
+	path := filepath.Join(dir, FileName)
+	if len(all) == 0 {
+		if err := fsys.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "couldn't remove tags")
+		}
+		return nil
+	}
+
+	b, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode tags")
+	}
+	tmp := path + ".gorganize-tmp"
+	out, err := vfs.Create(fsys, tmp)
+	if err != nil {
+		return errors.Wrap(err, "couldn't write tags")
+	}
+	_, err = out.Write(append(b, '\n'))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fsys.Remove(tmp)
+		return errors.Wrap(err, "couldn't write tags")
+	}
+	return errors.Wrap(fsys.Rename(tmp, path), "couldn't move tags into place")
+}
@@ -0,0 +1,107 @@
+package unzip
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deckarep/gorganize/file_management/archive"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnsafePath is returned for entries that would be written outside of
+	// the extraction destination.
+	ErrUnsafePath = errors.New("unsafe path in archive")
+	// ErrLimitExceeded is returned when an archive exceeds the extraction Limits.
+	ErrLimitExceeded = archive.ErrLimitExceeded
+)
+
+// Limits caps what a single archive may expand to, see archive.Limits.
+type Limits = archive.Limits
+
+// DefaultLimits are generous enough for photo deliveries while still stopping
+// zip bombs.
+var DefaultLimits = archive.DefaultLimits
+
+// safeJoin joins an archive entry name onto dest, rejecting absolute names and
+// names that climb out of dest.
+func safeJoin(dest, name string) (string, error) {
+	if name == "" || strings.ContainsRune(name, 0) {
+		return "", errors.Wrapf(ErrUnsafePath, "invalid entry name %q", name)
+	}
+
+	// Archives created on Windows may use backslashes.
+	slashed := strings.Replace(name, "\\", "/", -1)
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" ||
+		(len(slashed) > 1 && slashed[1] == ':') {
+		return "", errors.Wrapf(ErrUnsafePath, "absolute entry name %q", name)
+	}
+
+	path := filepath.Join(dest, filepath.FromSlash(slashed))
+	rel, err := filepath.Rel(dest, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.Wrapf(ErrUnsafePath, "entry name escapes destination %q", name)
+	}
+	return path, nil
+}
+
+// checkNoSymlinks makes sure none of the existing directories between dest
+// and path is a symlink, otherwise an earlier entry could redirect later ones
+// outside of dest.
+func checkNoSymlinks(fsys vfs.FS, dest, path string) error {
+	rel, err := filepath.Rel(dest, filepath.Dir(path))
+	if err != nil || rel == "." {
+		return nil
+	}
+
+	current := dest
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := fsys.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "couldn't stat %s", current)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return errors.Wrapf(ErrUnsafePath, "entry %s goes through symlink %s", path, current)
+		}
+	}
+	return nil
+}
+
+// checkLinkTarget rejects symlink targets that resolve outside of dest. The
+// text of the target alone isn't enough once links chain: with t -> . already
+// extracted, s -> t/.. climbs out of dest through t. So ".." is only accepted
+// at the start of a target, where it climbs from the real folder holding the
+// link, after that a target only ever goes down, through whichever links.
+func checkLinkTarget(dest, link, target string) error {
+	slashed := strings.Replace(target, "\\", "/", -1)
+	if filepath.IsAbs(target) || strings.HasPrefix(slashed, "/") || filepath.VolumeName(target) != "" ||
+		(len(slashed) > 1 && slashed[1] == ':') {
+		return errors.Wrapf(ErrUnsafePath, "symlink %s has absolute target %q", link, target)
+	}
+
+	named := false
+	for _, part := range strings.Split(slashed, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if named {
+				return errors.Wrapf(ErrUnsafePath, "symlink %s climbs back up in %q", link, target)
+			}
+		default:
+			named = true
+		}
+	}
+
+	resolved := filepath.Join(filepath.Dir(link), filepath.FromSlash(slashed))
+	rel, err := filepath.Rel(dest, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.Wrapf(ErrUnsafePath, "symlink %s escapes destination via %q", link, target)
+	}
+	return nil
+}
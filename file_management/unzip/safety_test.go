@@ -0,0 +1,230 @@
+package unzip
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestSafeJoin(t *testing.T) {
+	dest := filepath.FromSlash("/out")
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"a.txt", true},
+		{"dir/a.txt", true},
+		{"dir/../a.txt", true},
+		{"../a.txt", false},
+		{"dir/../../a.txt", false},
+		{"..\\a.txt", false},
+		{"/etc/passwd", false},
+		{"\\etc\\passwd", false},
+		{"C:\\Windows\\win.ini", false},
+		{"c:/a.txt", false},
+		{"", false},
+		{"a\x00b", false},
+	}
+	for _, test := range tests {
+		_, err := safeJoin(dest, test.name)
+		if test.ok && err != nil {
+			t.Errorf("safeJoin(%q) failed: %s", test.name, err)
+		}
+		if !test.ok && errors.Cause(err) != ErrUnsafePath {
+			t.Errorf("safeJoin(%q) = %v, want ErrUnsafePath", test.name, err)
+		}
+	}
+}
+
+func TestCheckLinkTarget(t *testing.T) {
+	dest := filepath.FromSlash("/out")
+	tests := []struct {
+		link, target string
+		ok           bool
+	}{
+		{"a", "b", true},
+		{"a", ".", true},
+		{"dir/a", "../b", true},
+		{"dir/a", "./sub/b", true},
+		{"a", "../b", false},
+		{"dir/a", "../../b", false},
+		{"a", "/etc/passwd", false},
+		{"a", "\\etc\\passwd", false},
+		{"a", "C:\\Windows", false},
+		// A link through an earlier link, such as t -> ., could climb out.
+		{"s", "t/..", false},
+		{"dir/s", "../t/../dir", false},
+	}
+	for _, test := range tests {
+		link := filepath.Join(dest, filepath.FromSlash(test.link))
+		err := checkLinkTarget(dest, link, test.target)
+		if test.ok && err != nil {
+			t.Errorf("checkLinkTarget(%s -> %s) failed: %s", test.link, test.target, err)
+		}
+		if !test.ok && errors.Cause(err) != ErrUnsafePath {
+			t.Errorf("checkLinkTarget(%s -> %s) = %v, want ErrUnsafePath", test.link, test.target, err)
+		}
+	}
+}
+
+// tempDir makes a folder for one test, call the returned func to remove it.
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "unzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// entry is a file or, when link is set, a symlink written by the helpers.
+type entry struct {
+	name, link, body string
+}
+
+func writeTar(t *testing.T, path string, entries []entry) {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.link != "" {
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeZip(t *testing.T, path string, entries []entry) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		f, err := w.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// extractInto extracts the archive at path into a fresh folder inside dir
+// and returns that folder along with the result.
+func extractInto(t *testing.T, dir, path string, opts Options) (string, ArchiveResult) {
+	opts.Dest = filepath.Join(dir, "out")
+	if err := os.Mkdir(opts.Dest, 0777); err != nil {
+		t.Fatal(err)
+	}
+	return opts.Dest, Archive(context.Background(), path, opts)
+}
+
+func assertEmpty(t *testing.T, dir string) {
+	t.Helper()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		t.Errorf("%s was left behind", filepath.Join(dir, info.Name()))
+	}
+}
+
+func TestExtractRejectsUnsafeEntries(t *testing.T) {
+	tests := map[string][]entry{
+		"traversal":      {{name: "a.txt", body: "a"}, {name: "../evil.txt", body: "evil"}},
+		"after a nested": {{name: "photos/2017/a.jpg", body: "a"}, {name: "../evil.txt", body: "evil"}},
+		"absolute":       {{name: "a.txt", body: "a"}, {name: "/tmp/evil.txt", body: "evil"}},
+		"link escape":    {{name: "up", link: "../.."}},
+		"link absolute":  {{name: "etc", link: "/etc"}},
+		"link chain":     {{name: "t", link: "."}, {name: "s", link: "t/.."}},
+		"through a link": {{name: "t", link: "."}, {name: "t/evil.txt", body: "evil"}},
+	}
+	for name, entries := range tests {
+		for _, keepGoing := range []bool{false, true} {
+			dir, done := tempDir(t)
+			defer done()
+			path := filepath.Join(dir, "pack.tar")
+			writeTar(t, path, entries)
+
+			dest, ar := extractInto(t, dir, path, Options{KeepGoing: keepGoing})
+			if errors.Cause(ar.Err) != ErrUnsafePath {
+				t.Errorf("%s (keep going %v): got %v, want ErrUnsafePath", name, keepGoing, ar.Err)
+			}
+			assertEmpty(t, dest)
+			if _, err := os.Lstat(filepath.Join(dir, "evil.txt")); err == nil {
+				t.Errorf("%s (keep going %v): evil.txt was written outside of dest", name, keepGoing)
+			}
+		}
+	}
+}
+
+func TestExtractEnforcesLimits(t *testing.T) {
+	zeros := string(make([]byte, 4<<20))
+	tests := []struct {
+		name    string
+		entries []entry
+		limits  Limits
+	}{
+		{"entries", []entry{{name: "a", body: "a"}, {name: "b", body: "b"}, {name: "c", body: "c"}}, Limits{MaxEntries: 2}},
+		{"bytes", []entry{{name: "a", body: "0123456789"}, {name: "b", body: "0123456789"}}, Limits{MaxBytes: 15}},
+		{"ratio", []entry{{name: "small", body: "a"}, {name: "bomb", body: zeros}}, Limits{MaxRatio: 100}},
+	}
+	for _, test := range tests {
+		for _, keepGoing := range []bool{false, true} {
+			dir, done := tempDir(t)
+			defer done()
+			path := filepath.Join(dir, "pack.zip")
+			writeZip(t, path, test.entries)
+
+			dest, ar := extractInto(t, dir, path, Options{Limits: test.limits, KeepGoing: keepGoing})
+			if errors.Cause(ar.Err) != ErrLimitExceeded {
+				t.Errorf("%s (keep going %v): got %v, want ErrLimitExceeded", test.name, keepGoing, ar.Err)
+			}
+			assertEmpty(t, dest)
+		}
+	}
+}
+
+func TestExtractKeepsSafeLinks(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "pack.tar")
+	writeTar(t, path, []entry{
+		{name: "photos/a.jpg", body: "a"},
+		{name: "latest", link: "photos/a.jpg"},
+		{name: "photos/all", link: "."},
+	})
+
+	dest, ar := extractInto(t, dir, path, Options{})
+	if ar.Err != nil {
+		t.Fatal(ar.Err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dest, "latest"))
+	if err != nil || string(b) != "a" {
+		t.Errorf("latest reads %q, %v", b, err)
+	}
+}
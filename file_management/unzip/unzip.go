@@ -1,67 +1,771 @@
 package unzip
 
 import (
-	"archive/zip"
+	"context"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/deckarep/gorganize/file_management/archive"
+	"github.com/deckarep/gorganize/file_management/logging"
+	md5 "github.com/deckarep/gorganize/file_management/md5"
+	"github.com/deckarep/gorganize/file_management/op"
+	"github.com/deckarep/gorganize/file_management/progress"
+	"github.com/deckarep/gorganize/file_management/vfs"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
-func All(sourceFolder string) {
-	err := filepath.Walk(sourceFolder, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
+// Layout decides where the entries of each archive end up.
+type Layout string
+
+const (
+	// LayoutPerArchive extracts each archive into its own folder below the
+	// destination, named after the archive.
+	LayoutPerArchive Layout = "per-archive"
+	// LayoutAlongside extracts each archive into the folder containing it.
+	LayoutAlongside Layout = "alongside"
+	// LayoutMerged extracts every archive straight into the destination.
+	LayoutMerged Layout = "merged"
+)
+
+// ParseLayout validates a layout name.
+func ParseLayout(name string) (Layout, error) {
+	switch l := Layout(name); l {
+	case LayoutPerArchive, LayoutAlongside, LayoutMerged:
+		return l, nil
+	}
+	return "", errors.Errorf("unknown layout: %s, expected per-archive, alongside or merged", name)
+}
+
+// Options controls where and how archives are extracted.
+type Options struct {
+	// Dest is the destination folder, it defaults to the source folder, or
+	// the folder holding the source when it is an archive itself.
+	Dest   string
+	Layout Layout
+	Limits Limits
+	// RecursiveDepth is how many levels of archives found inside extracted
+	// archives are extracted in turn, 0 only extracts what is on disk.
+	RecursiveDepth int
+	// Only restricts extraction to matching entries, nil extracts everything.
+	Only *op.Selection
+	// Flatten drops the folder structure of entries, writing them straight
+	// into the destination.
+	Flatten bool
+	// KeepGoing skips entries that fail to extract instead of failing and
+	// rolling back their whole archive. Unsafe entries and exceeded limits
+	// still fail the archive.
+	KeepGoing bool
+	// Charset decodes entry names that aren't UTF-8, it defaults to cp437.
+	Charset archive.Charset
+	// Collision is what to do when a different file already has an entry's
+	// name, it defaults to op.CollisionRename.
+	Collision op.Collision
+	Logger    logging.Logger
+	// FS is where archives are read and extracted to, it defaults to vfs.OS.
+	FS vfs.FS
+	// Progress receives progress events counted in archives, nil reports
+	// nothing.
+	Progress progress.Reporter
+}
+
+// ArchiveResult is the outcome of extracting a single archive.
+type ArchiveResult struct {
+	Path string
+	Dest string
+	// Written are the files created, nothing is kept when Err is set.
+	Written []string
+	// Replaced are the files in Written that overwrote a different file
+	// under op.CollisionOverwrite.
+	Replaced []string
+	// Duplicate is set when identical content was already extracted.
+	Duplicate bool
+	// Failed are the entries skipped under KeepGoing.
+	Failed []EntryError
+	// Bytes is the size of the files written.
+	Bytes int64
+	Err   error
+}
+
+// Result is the outcome of All, archives are listed in extraction order.
+type Result struct {
+	Archives []ArchiveResult
+	// Elapsed is how long extraction took.
+	Elapsed time.Duration
+}
+
+// FailedArchives counts the archives that couldn't be extracted.
+func (r *Result) FailedArchives() int {
+	n := 0
+	for _, a := range r.Archives {
+		if a.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Stats sums up an extraction.
+type Stats struct {
+	// Extracted, Duplicates and Failed count archives.
+	Extracted  int
+	Duplicates int
+	Failed     int
+	// Entries and FailedEntries count the files of the archives.
+	Entries       int
+	FailedEntries int
+	Bytes         int64
+	Elapsed       time.Duration
+}
+
+// Stats sums up r.
+func (r *Result) Stats() Stats {
+	s := Stats{Elapsed: r.Elapsed}
+	for _, a := range r.Archives {
+		switch {
+		case a.Err != nil:
+			s.Failed++
+		case a.Duplicate:
+			s.Duplicates++
+		default:
+			s.Extracted++
+		}
+		s.Entries += len(a.Written)
+		s.FailedEntries += len(a.Failed)
+		s.Bytes += a.Bytes
+	}
+	return s
+}
+
+// Add combines the stats of two extractions.
+func (s Stats) Add(o Stats) Stats {
+	return Stats{
+		Extracted:     s.Extracted + o.Extracted,
+		Duplicates:    s.Duplicates + o.Duplicates,
+		Failed:        s.Failed + o.Failed,
+		Entries:       s.Entries + o.Entries,
+		FailedEntries: s.FailedEntries + o.FailedEntries,
+		Bytes:         s.Bytes + o.Bytes,
+		Elapsed:       s.Elapsed + o.Elapsed,
+	}
+}
+
+// FailedEntries collects the entries skipped under KeepGoing.
+func (r *Result) FailedEntries() []EntryError {
+	var failed []EntryError
+	for _, a := range r.Archives {
+		failed = append(failed, a.Failed...)
+	}
+	return failed
+}
+
+// All extracts every archive found below sourceFolder. Archives are
+// recognized by their content, but only files named like archives are
+// looked at, see archive.HasExt. Archives that fail are recorded in the
+// result and the others are still extracted, the returned error is reserved
+// for ctx being done.
+func All(ctx context.Context, sourceFolder string, opts Options) (*Result, error) {
+	fsys := vfs.Or(opts.FS)
+	if opts.Dest == "" {
+		opts.Dest = sourceFolder
+		if info, err := fsys.Stat(sourceFolder); err == nil && !info.IsDir() {
+			opts.Dest = filepath.Dir(sourceFolder)
+		}
+	}
+	if opts.Layout == "" {
+		opts.Layout = LayoutPerArchive
+	}
+	if opts.Charset.Name == "" {
+		opts.Charset = archive.DefaultCharset
+	}
+	log := logging.Or(opts.Logger)
+	result := &Result{}
+	start := time.Now()
+	defer func() { result.Elapsed = time.Since(start) }()
+	tracker := progress.NewTracker("extract", opts.Progress)
+	defer tracker.Done()
+
+	// Collect first so folders created by the extraction aren't walked.
+	var archives []string
+	formats := make(map[string]archive.Format)
+	sizes := make(map[string]int64)
+	err := vfs.Walk(fsys, sourceFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Errorf("Couldn't walk: %s with err: %s", path, err)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// A folder is only searched for files named like archives, a file
+		// given as the source is sniffed whatever its name.
+		if info.IsDir() || (path != sourceFolder && !archive.HasExt(path)) {
 			return nil
 		}
 
-		if filepath.Ext(path) == ".zip" {
-			err := unzip(path, filepath.Join(sourceFolder, "C"))
-			if err != nil {
-				logrus.Error(err.Error())
-			}
+		format, err := archive.Detect(fsys, path)
+		if err != nil {
+			log.Errorf("%s", err)
+			return nil
+		}
+		if format != archive.Unknown {
+			archives = append(archives, path)
+			formats[path] = format
+			sizes[path] = info.Size()
+			tracker.Discovered(1, info.Size())
 		}
 		return nil
 	})
 	if err != nil {
-		logrus.Error("Error on filepath.Walk during unzipAll:", err.Error())
+		return result, err
+	}
+
+	queue := make([]pending, 0, len(archives))
+	for _, path := range archives {
+		queue = append(queue, pending{path: path, size: sizes[path], format: formats[path], dest: destFor(path, formats[path], opts)})
+	}
+
+	// Archives are remembered by content so the same payload, whether
+	// delivered twice or nested inside itself, is only extracted once.
+	seen := make(map[string]bool)
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		next := queue[0]
+		queue = queue[1:]
+		ar := ArchiveResult{Path: next.path, Dest: next.dest}
+		tracker.Start(next.path)
+
+		hash, err := md5.Sum(ctx, fsys, next.path)
+		if err != nil {
+			log.Errorf("%s", err)
+			ar.Err = err
+			result.Archives = append(result.Archives, ar)
+			tracker.Failed(next.size)
+			continue
+		}
+		if seen[hash] {
+			log.Infof("Identical archive already extracted:%s, skipping...", next.path)
+			ar.Duplicate = true
+			result.Archives = append(result.Archives, ar)
+			tracker.Skipped(next.size)
+			continue
+		}
+		seen[hash] = true
+
+		ar.Err = extract(ctx, next.path, next.dest, opts, tracker, &ar)
+		if ar.Err != nil {
+			log.Errorf("%s", ar.Err)
+			tracker.Failed(next.size)
+		} else {
+			tracker.Processed(next.size)
+		}
+		result.Archives = append(result.Archives, ar)
+
+		if next.depth >= opts.RecursiveDepth {
+			continue
+		}
+		for _, path := range ar.Written {
+			format, err := archive.Detect(fsys, path)
+			if err != nil || format == archive.Unknown {
+				continue
+			}
+			var size int64
+			if info, err := fsys.Stat(path); err == nil {
+				size = info.Size()
+			}
+			tracker.Discovered(1, size)
+			nested := opts
+			if opts.Layout != LayoutMerged {
+				nested.Dest = filepath.Dir(path)
+			}
+			queue = append(queue, pending{
+				path:   path,
+				size:   size,
+				format: format,
+				dest:   destFor(path, format, nested),
+				depth:  next.depth + 1,
+			})
+		}
+	}
+	return result, nil
+}
+
+// Archive extracts the single archive at path straight into opts.Dest, which
+// it requires. Layout and RecursiveDepth don't apply, archives inside are
+// written as they are.
+func Archive(ctx context.Context, path string, opts Options) ArchiveResult {
+	if opts.Charset.Name == "" {
+		opts.Charset = archive.DefaultCharset
+	}
+	ar := ArchiveResult{Path: path, Dest: opts.Dest}
+	if opts.Dest == "" {
+		ar.Err = errors.Errorf("no destination to extract %s to", path)
+		return ar
+	}
+	tracker := progress.NewTracker("extract", opts.Progress)
+	defer tracker.Done()
+
+	var size int64
+	if info, err := vfs.Or(opts.FS).Stat(path); err == nil {
+		size = info.Size()
+	}
+	tracker.Discovered(1, size)
+	tracker.Start(path)
+	ar.Err = extract(ctx, path, opts.Dest, opts, tracker, &ar)
+	if ar.Err != nil {
+		logging.Or(opts.Logger).Errorf("%s", ar.Err)
+		tracker.Failed(size)
+	} else {
+		tracker.Processed(size)
+	}
+	return ar
+}
+
+// pending is an archive waiting to be extracted.
+type pending struct {
+	path   string
+	size   int64
+	format archive.Format
+	dest   string
+	depth  int
+}
+
+func destFor(path string, format archive.Format, opts Options) string {
+	switch opts.Layout {
+	case LayoutAlongside:
+		return filepath.Dir(path)
+	case LayoutMerged:
+		return opts.Dest
+	}
+	// A lone compressed file would otherwise end up alone in a folder of
+	// its own name.
+	if format.Single() {
+		return opts.Dest
 	}
+	return filepath.Join(opts.Dest, archive.TrimExt(filepath.Base(path)))
 }
 
-func unzip(archive, dest string) error {
-	reader, err := zip.OpenReader(archive)
+// EntryError is an entry that couldn't be extracted while the rest of its
+// archive was.
+type EntryError struct {
+	Archive string
+	Entry   string
+	Err     error
+}
+
+func (e EntryError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Archive, e.Entry, e.Err)
+}
+
+// extract writes the entries of the archive at path below dest and records
+// the files it created and their total size in ar. Without KeepGoing the
+// first bad entry fails the whole archive and everything written so far is
+// removed, with it the bad entries are recorded and the rest of the archive is
+// extracted. Entries are shown on t as they are written.
+func extract(ctx context.Context, path, dest string, opts Options, t *progress.Tracker, ar *ArchiveResult) error {
+	fsys := vfs.Or(opts.FS)
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to stat archive: %s", path)
+	}
+
+	reader, _, err := archive.Open(fsys, path)
 	if err != nil {
-		return errors.Wrapf(err, "Failed to zip.OpenReader of archive: %s", archive)
+		return err
 	}
+	defer reader.Close()
 
-	if err := os.MkdirAll(dest, 0777); err != nil {
+	x := &extraction{
+		ctx:      ctx,
+		log:      logging.Or(opts.Logger),
+		fsys:     fsys,
+		path:     path,
+		dest:     dest,
+		opts:     opts,
+		reader:   reader,
+		progress: t,
+		budget:   archive.NewBudget(opts.Limits, info.Size()),
+	}
+	if err := x.mkdirAll(dest); err != nil {
+		x.rollback()
 		return errors.Wrapf(err, "Failed to MkdirAll of dest: %s", dest)
 	}
+	if err := x.run(); err != nil {
+		// A rejected archive leaves nothing behind.
+		x.rollback()
+		return errors.Wrapf(err, "archive %s", path)
+	}
+	x.commit()
+	ar.Written, ar.Failed, ar.Bytes = x.written, x.failed, x.bytes
+	for _, a := range x.asides {
+		ar.Replaced = append(ar.Replaced, a.path)
+	}
+	return nil
+}
 
-	for _, file := range reader.File {
-		path := filepath.Join(dest, file.Name)
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(path, file.Mode())
-			continue
-		}
+// extraction is the state of one archive being extracted.
+type extraction struct {
+	ctx      context.Context
+	log      logging.Logger
+	fsys     vfs.FS
+	path     string
+	dest     string
+	opts     Options
+	reader   archive.Reader
+	progress *progress.Tracker
+	budget   *archive.Budget
+	written  []string
+	bytes    int64
+	dirs     []*archive.Header
+	failed   []EntryError
+	// ours are the paths in written, later entries of the same name simply
+	// replace them.
+	ours map[string]bool
+	// asides are the files that were overwritten, moved out of the way until
+	// the archive is done.
+	asides []aside
+	// created are the directories this archive created, parents first.
+	created []string
+}
 
-		fileReader, err := file.Open()
+func (x *extraction) run() error {
+	for {
+		// Stopping between entries, the archive is rolled back as a whole.
+		if err := x.ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := x.reader.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return errors.Wrap(err, "Failed to open source file during uncompress")
+			return errors.Wrap(err, "Failed to read next entry")
+		}
+		if err := x.budget.Entry(); err != nil {
+			return err
+		}
+		if hdr.NonUTF8 {
+			hdr.Name = x.opts.Charset.Decode(hdr.Name)
 		}
-		defer fileReader.Close()
 
-		destFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-		if err != nil {
-			return errors.Wrap(err, "Failed to open dest file during uncompress")
+		x.progress.Start(x.path + "!" + hdr.Name)
+		if err := x.entry(hdr); err != nil {
+			// Unsafe paths and exceeded limits mean a hostile archive, never
+			// keep going.
+			if cause := errors.Cause(err); !x.opts.KeepGoing || cause == ErrUnsafePath || cause == ErrLimitExceeded {
+				return err
+			}
+			x.log.Warnf("Failed to extract %s from %s: %s", hdr.Name, x.path, err.Error())
+			x.failed = append(x.failed, EntryError{Archive: x.path, Entry: hdr.Name, Err: err})
+		}
+	}
+
+	// Directory times last, writing their contents bumped them.
+	for _, hdr := range x.dirs {
+		if !hdr.ModTime.IsZero() {
+			target, _ := safeJoin(x.dest, hdr.Name)
+			x.fsys.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		}
+	}
+	return nil
+}
+
+// entry extracts a single entry. Each entry is completely written and closed
+// before the next one is read.
+func (x *extraction) entry(hdr *archive.Header) error {
+	target, err := safeJoin(x.dest, hdr.Name)
+	if err != nil {
+		return err
+	}
+	if err := checkNoSymlinks(x.fsys, x.dest, target); err != nil {
+		return err
+	}
+
+	switch {
+	case hdr.Type == archive.TypeDir:
+		if x.opts.Only.Empty() && !x.opts.Flatten {
+			x.dirs = append(x.dirs, hdr)
+			return errors.Wrap(x.mkdirAll(target), "Failed to create dir during uncompress")
 		}
-		defer destFile.Close()
+		return nil
+	case hdr.Type == archive.TypeOther:
+		x.log.Warnf("Skipping unsupported entry type: %s", hdr.Name)
+		return nil
+	case !x.opts.Only.Match(hdr.Name):
+		return nil
+	}
 
-		if _, err := io.Copy(destFile, fileReader); err != nil {
-			return errors.Wrap(err, "Failed to io.Copy file during uncompress")
+	if x.opts.Flatten {
+		// The name was validated above, only its base is used.
+		target = filepath.Join(x.dest, filepath.Base(target))
+	}
+
+	if err := x.mkdirAll(filepath.Dir(target)); err != nil {
+		return errors.Wrap(err, "Failed to create parent dir during uncompress")
+	}
+
+	if hdr.Type == archive.TypeSymlink {
+		placed, err := x.writeSymlink(target, hdr.Linkname)
+		if err != nil {
+			return err
 		}
+		x.wrote(placed)
+		return nil
+	}
+
+	if err := x.budget.Admit(hdr.Name, hdr.CompressedSize, hdr.Size); err != nil {
+		return err
+	}
+
+	placed, n, err := x.writeEntry(x.budget.Reader(x.reader), target, hdr)
+	if err != nil {
+		return err
+	}
+	if placed != "" {
+		x.wrote(placed)
+		x.bytes += n
 	}
+	return nil
+}
 
+// mkdirAll creates dir along with any missing parents and records the ones
+// it created.
+func (x *extraction) mkdirAll(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := x.fsys.Lstat(d); err == nil || d == filepath.Dir(d) {
+			break
+		}
+		missing = append(missing, d)
+	}
+	if err := x.fsys.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		x.created = append(x.created, missing[i])
+	}
 	return nil
 }
+
+// wrote records that path was written by this archive.
+func (x *extraction) wrote(path string) {
+	if path == "" || x.ours[path] {
+		return
+	}
+	if x.ours == nil {
+		x.ours = make(map[string]bool)
+	}
+	x.ours[path] = true
+	x.written = append(x.written, path)
+}
+
+// aside is a file about to be overwritten, kept under backup until the
+// archive is done.
+type aside struct {
+	path   string
+	backup string
+}
+
+// setAside moves the file at path out of the way before it is overwritten,
+// so a rollback can put it back. It returns a func undoing just that, for
+// when the overwrite itself fails. Files this archive wrote aren't kept.
+func (x *extraction) setAside(path string) (func(), error) {
+	if x.ours[path] {
+		return func() {}, nil
+	}
+	backup := path + ".gorganize-orig"
+	if err := x.fsys.Rename(path, backup); err != nil {
+		return nil, errors.Wrap(err, "Failed to set aside the file being overwritten")
+	}
+	x.asides = append(x.asides, aside{path: path, backup: backup})
+	return func() {
+		x.fsys.Rename(backup, path)
+		x.asides = x.asides[:len(x.asides)-1]
+	}, nil
+}
+
+// rollback removes everything the archive wrote, and the directories it
+// created once empty, and puts back the files it overwrote.
+func (x *extraction) rollback() {
+	for _, path := range x.written {
+		x.fsys.Remove(path)
+	}
+	for i := len(x.created) - 1; i >= 0; i-- {
+		x.fsys.Remove(x.created[i])
+	}
+	for i := len(x.asides) - 1; i >= 0; i-- {
+		a := x.asides[i]
+		if err := x.fsys.Rename(a.backup, a.path); err != nil {
+			x.log.Errorf("Couldn't restore %s, it is kept as %s: %s", a.path, a.backup, err)
+		}
+	}
+}
+
+// commit drops the overwritten files once the archive is extracted.
+func (x *extraction) commit() {
+	for _, a := range x.asides {
+		if err := x.fsys.Remove(a.backup); err != nil {
+			x.log.Warnf("Couldn't remove %s: %s", a.backup, err)
+		}
+	}
+}
+
+// writeEntry writes r to a temp file next to path first, so a name already
+// taken by another archive goes through the same collision rules as copy. The
+// entry's mode and modification time are restored on the result. The size of
+// the entry is returned along with where it ended up.
+func (x *extraction) writeEntry(r io.Reader, path string, hdr *archive.Header) (string, int64, error) {
+	// Archives made on DOS and Windows carry no permissions at all.
+	mode := hdr.Mode.Perm()
+	if mode == 0 {
+		mode = 0666
+	}
+
+	tmp := path + ".gorganize-tmp"
+	destFile, err := x.fsys.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "Failed to open dest file during uncompress")
+	}
+
+	n, err := io.Copy(destFile, r)
+	if closeErr := destFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		x.fsys.Remove(tmp)
+		return "", 0, errors.Wrap(err, "Failed to io.Copy file during uncompress")
+	}
+
+	// OpenFile is subject to the umask, the archive's mode is not.
+	if hdr.Mode.Perm() != 0 {
+		x.fsys.Chmod(tmp, hdr.Mode.Perm())
+	}
+	if !hdr.ModTime.IsZero() {
+		x.fsys.Chtimes(tmp, hdr.ModTime, hdr.ModTime)
+	}
+
+	placed, err := x.placeEntry(tmp, path)
+	return placed, n, err
+}
+
+// placeEntry moves an extracted temp file to path, or where the collision
+// policy says when path already holds different content. It returns the final
+// path or "" when nothing was placed because path was kept.
+func (x *extraction) placeEntry(tmp, path string) (string, error) {
+	target, action, err := op.Resolve(x.ctx, x.fsys, tmp, path, x.opts.Collision)
+	if err != nil {
+		x.fsys.Remove(tmp)
+		return "", err
+	}
+	switch action {
+	case op.Identical:
+		x.log.Infof("Exact match found:%s, skipping...", filepath.Base(path))
+		return "", x.fsys.Remove(tmp)
+	case op.Existing:
+		x.log.Infof("Different file found:%s, keeping it and skipping...", filepath.Base(path))
+		return "", x.fsys.Remove(tmp)
+	}
+
+	restore := func() {}
+	if action == op.Overwritten {
+		if restore, err = x.setAside(target); err != nil {
+			x.fsys.Remove(tmp)
+			return "", err
+		}
+	}
+	if err := x.fsys.Rename(tmp, target); err != nil {
+		x.fsys.Remove(tmp)
+		restore()
+		return "", errors.Wrap(err, "Failed to move extracted file into place")
+	}
+	return target, nil
+}
+
+// writeSymlink recreates a symlink entry, refusing targets that would point
+// outside of dest. An existing path goes through the collision policy like
+// files do, a symlink with the same target counts as identical. It returns
+// where the link ended up or "" when nothing was written.
+func (x *extraction) writeSymlink(path, linkname string) (string, error) {
+	if linkname == "" {
+		return "", errors.Errorf("symlink %s has no target", path)
+	}
+	if err := checkLinkTarget(x.dest, path, linkname); err != nil {
+		return "", err
+	}
+
+	target, action, err := x.resolveSymlink(path, linkname)
+	if err != nil {
+		return "", err
+	}
+	switch action {
+	case op.Identical:
+		x.log.Infof("Exact match found:%s, skipping...", filepath.Base(path))
+		return "", nil
+	case op.Existing:
+		x.log.Infof("Different file found:%s, keeping it and skipping...", filepath.Base(path))
+		return "", nil
+	}
+
+	restore := func() {}
+	if action == op.Overwritten {
+		if restore, err = x.setAside(target); err != nil {
+			return "", err
+		}
+		// Unlike a rename, a symlink doesn't replace a link of our own.
+		if x.ours[target] {
+			x.fsys.Remove(target)
+		}
+	}
+	if err := x.fsys.Symlink(linkname, target); err != nil {
+		restore()
+		return "", errors.Wrap(err, "Failed to create symlink")
+	}
+	return target, nil
+}
+
+// resolveSymlink is op.Resolve for a symlink to linkname. Renamed links are
+// suffixed with part of the checksum of their target.
+func (x *extraction) resolveSymlink(path, linkname string) (string, op.Action, error) {
+	info, err := x.fsys.Lstat(path)
+	if os.IsNotExist(err) {
+		return path, op.Copied, nil
+	}
+	if err != nil {
+		return "", op.Failed, errors.Wrap(err, "Failed to stat symlink destination")
+	}
+	if x.sameLink(path, linkname) {
+		return path, op.Identical, nil
+	}
+	switch x.opts.Collision {
+	case op.CollisionSkip:
+		return path, op.Existing, nil
+	case op.CollisionOverwrite:
+		if info.IsDir() {
+			return "", op.Failed, errors.Errorf("%s is a folder, a symlink can't replace it", path)
+		}
+		return path, op.Overwritten, nil
+	}
+
+	ext := filepath.Ext(path)
+	suffix := fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(linkname)))[:5]
+	renamed := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, ext), suffix, ext)
+	if _, err := x.fsys.Lstat(renamed); os.IsNotExist(err) {
+		return renamed, op.Renamed, nil
+	}
+	if x.sameLink(renamed, linkname) {
+		return renamed, op.Identical, nil
+	}
+	return "", op.Failed, errors.Errorf("%s and %s are both taken", path, renamed)
+}
+
+// sameLink reports whether path is a symlink to linkname.
+func (x *extraction) sameLink(path, linkname string) bool {
+	existing, err := x.fsys.Readlink(path)
+	return err == nil && existing == linkname
+}
@@ -0,0 +1,195 @@
+package unzip
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/deckarep/gorganize/file_management/op"
+)
+
+func TestAllDefaultsDestNextToArchive(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "pack.zip")
+	writeZip(t, path, []entry{{name: "a.txt", body: "a"}})
+
+	result, err := All(context.Background(), path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := result.FailedArchives(); n != 0 {
+		t.Fatalf("%d archive(s) failed: %v", n, result.Archives[0].Err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pack", "a.txt")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAllLeavesDocumentsAlone(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	// Office documents are zips, only files named like archives are
+	// extracted from a folder.
+	writeZip(t, filepath.Join(dir, "report.docx"), []entry{{name: "document.xml", body: "<doc/>"}})
+	writeZip(t, filepath.Join(dir, "PACK.ZIP"), []entry{{name: "a.txt", body: "a"}})
+
+	result, err := All(context.Background(), dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Archives) != 1 || result.Archives[0].Path != filepath.Join(dir, "PACK.ZIP") {
+		t.Fatalf("extracted %v, want only PACK.ZIP", result.Archives)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "report")); !os.IsNotExist(err) {
+		t.Errorf("report.docx was extracted: %v", err)
+	}
+
+	// Named on its own, a document is extracted.
+	result, err = All(context.Background(), filepath.Join(dir, "report.docx"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Archives) != 1 || result.Archives[0].Err != nil {
+		t.Fatalf("got %v, want report.docx extracted", result.Archives)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "report", "document.xml")); err != nil {
+		t.Error(err)
+	}
+}
+
+// readTree returns what every file and symlink below dir holds, by relative
+// path, symlinks as "-> target".
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	found := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			found[rel] = "-> " + link
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		found[rel] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func assertTree(t *testing.T, dir string, want map[string]string) {
+	t.Helper()
+	got := readTree(t, dir)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s holds %v, want %v", dir, got, want)
+	}
+}
+
+func TestRollbackRestoresOverwrittenFiles(t *testing.T) {
+	for _, keepGoing := range []bool{false, true} {
+		dir, done := tempDir(t)
+		defer done()
+		path := filepath.Join(dir, "evil.tar")
+		writeTar(t, path, []entry{
+			{name: "a.txt", body: "from archive"},
+			{name: "b.txt", body: "new b"},
+			{name: "b.txt", body: "newer b"},
+			{name: "link", link: "b.txt"},
+			{name: "../evil.txt", body: "evil"},
+		})
+		dest := filepath.Join(dir, "out")
+		if err := os.Mkdir(dest, 0777); err != nil {
+			t.Fatal(err)
+		}
+		original := map[string]string{"a.txt": "PRECIOUS ORIGINAL", "link": "-> a.txt"}
+		if err := ioutil.WriteFile(filepath.Join(dest, "a.txt"), []byte(original["a.txt"]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("a.txt", filepath.Join(dest, "link")); err != nil {
+			t.Fatal(err)
+		}
+
+		ar := Archive(context.Background(), path, Options{Dest: dest, KeepGoing: keepGoing, Collision: op.CollisionOverwrite})
+		if ar.Err == nil {
+			t.Fatalf("keep going %v: unsafe archive was extracted", keepGoing)
+		}
+		assertTree(t, dest, original)
+	}
+}
+
+func TestOverwriteKeepsNothingAside(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "pack.tar")
+	writeTar(t, path, []entry{
+		{name: "a.txt", body: "from archive"},
+		{name: "link", link: "a.txt"},
+	})
+	dest := filepath.Join(dir, "out")
+	if err := os.Mkdir(dest, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dest, "a.txt"), []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("elsewhere", filepath.Join(dest, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	ar := Archive(context.Background(), path, Options{Dest: dest, Collision: op.CollisionOverwrite})
+	if ar.Err != nil {
+		t.Fatal(ar.Err)
+	}
+	assertTree(t, dest, map[string]string{"a.txt": "from archive", "link": "-> a.txt"})
+}
+
+func TestSymlinkCollisions(t *testing.T) {
+	tests := []struct {
+		policy op.Collision
+		want   map[string]string
+	}{
+		{op.CollisionSkip, map[string]string{"a.txt": "a", "link": "-> other"}},
+		{op.CollisionOverwrite, map[string]string{"a.txt": "a", "link": "-> a.txt"}},
+		{op.CollisionRename, map[string]string{"a.txt": "a", "link": "-> other", "link-" + linkSuffix("a.txt"): "-> a.txt"}},
+	}
+	for _, tt := range tests {
+		dir, done := tempDir(t)
+		defer done()
+		path := filepath.Join(dir, "pack.tar")
+		writeTar(t, path, []entry{{name: "a.txt", body: "a"}, {name: "link", link: "a.txt"}})
+		dest := filepath.Join(dir, "out")
+		if err := os.Mkdir(dest, 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("other", filepath.Join(dest, "link")); err != nil {
+			t.Fatal(err)
+		}
+
+		ar := Archive(context.Background(), path, Options{Dest: dest, Collision: tt.policy})
+		if ar.Err != nil {
+			t.Fatalf("%s: %s", tt.policy, ar.Err)
+		}
+		assertTree(t, dest, tt.want)
+
+		// Extracting again finds identical links and changes nothing.
+		if ar := Archive(context.Background(), path, Options{Dest: dest, Collision: tt.policy}); ar.Err != nil || len(ar.Written) != 0 {
+			t.Errorf("%s: extracting again wrote %v, %v", tt.policy, ar.Written, ar.Err)
+		}
+		assertTree(t, dest, tt.want)
+	}
+}
+
+func linkSuffix(target string) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(target)))[:5]
+}
@@ -0,0 +1,487 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Mem is a filesystem held entirely in memory, safe for concurrent use. Both
+// "/" and "." exist from the start so absolute and relative paths work.
+// Symlinks are followed for the last element of a path only.
+type Mem struct {
+	mu    sync.Mutex
+	nodes map[string]*inode
+}
+
+// inode is shared by every name hard linked to it.
+type inode struct {
+	mode    os.FileMode
+	modTime time.Time
+	data    []byte
+	target  string
+}
+
+// NewMem returns an empty in-memory filesystem.
+func NewMem() *Mem {
+	now := time.Now()
+	return &Mem{nodes: map[string]*inode{
+		"/": {mode: os.ModeDir | 0777, modTime: now},
+		".": {mode: os.ModeDir | 0777, modTime: now},
+	}}
+}
+
+// maxSymlinks is how many links are followed before giving up, like ELOOP.
+const maxSymlinks = 40
+
+// lookup returns the cleaned name and its inode, nil when it doesn't exist.
+// With follow the final symlinks are resolved. m.mu must be held.
+func (m *Mem) lookup(name string, follow bool) (string, *inode, error) {
+	key := filepath.Clean(name)
+	for i := 0; i < maxSymlinks; i++ {
+		n := m.nodes[key]
+		if n == nil || !follow || n.mode&os.ModeSymlink == 0 {
+			return key, n, nil
+		}
+		target := n.target
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(key), target)
+		}
+		key = filepath.Clean(target)
+	}
+	return key, nil, syscall.ELOOP
+}
+
+// parentDir makes sure the directory that would hold key exists.
+func (m *Mem) parentDir(key string) error {
+	parent := filepath.Dir(key)
+	if parent == key {
+		return nil
+	}
+	_, n, err := m.lookup(parent, true)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return os.ErrNotExist
+	}
+	if !n.mode.IsDir() {
+		return syscall.ENOTDIR
+	}
+	return nil
+}
+
+// children lists the names directly below key. m.mu must be held.
+func (m *Mem) children(key string) []string {
+	var names []string
+	for name := range m.nodes {
+		if name != key && filepath.Dir(name) == key {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *Mem) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *Mem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, n, err := m.lookup(name, true)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+
+	switch {
+	case n == nil && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case n == nil:
+		if err := m.parentDir(key); err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		n = &inode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[key] = n
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case n.mode.IsDir() && writable:
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case flag&os.O_TRUNC != 0 && writable:
+		n.data = nil
+		n.modTime = time.Now()
+	}
+	return &memFile{fs: m, name: name, node: n, flag: flag}, nil
+}
+
+func (m *Mem) Stat(name string) (os.FileInfo, error) {
+	return m.stat("stat", name, true)
+}
+
+func (m *Mem) Lstat(name string) (os.FileInfo, error) {
+	return m.stat("lstat", name, false)
+}
+
+func (m *Mem) stat(op, name string, follow bool) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, n, err := m.lookup(name, follow)
+	if err == nil && n == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return n.info(filepath.Base(key)), nil
+}
+
+func (m *Mem) ReadDir(name string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, n, err := m.lookup(name, true)
+	if err == nil && n == nil {
+		err = os.ErrNotExist
+	}
+	if err == nil && !n.mode.IsDir() {
+		err = syscall.ENOTDIR
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	var infos []os.FileInfo
+	for _, child := range m.children(key) {
+		infos = append(infos, m.nodes[child].info(filepath.Base(child)))
+	}
+	return infos, nil
+}
+
+func (m *Mem) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := filepath.Clean(path)
+	var missing []string
+	for dir := key; ; dir = filepath.Dir(dir) {
+		_, n, err := m.lookup(dir, true)
+		if err != nil {
+			return &os.PathError{Op: "mkdir", Path: dir, Err: err}
+		}
+		if n != nil {
+			if !n.mode.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	now := time.Now()
+	for i := len(missing) - 1; i >= 0; i-- {
+		m.nodes[missing[i]] = &inode{mode: os.ModeDir | perm.Perm(), modTime: now}
+	}
+	return nil
+}
+
+func (m *Mem) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+
+	oldKey, n, _ := m.lookup(oldpath, false)
+	if n == nil {
+		return linkErr(os.ErrNotExist)
+	}
+	newKey, existing, _ := m.lookup(newpath, false)
+	if oldKey == newKey {
+		return nil
+	}
+	if err := m.parentDir(newKey); err != nil {
+		return linkErr(err)
+	}
+	if n.mode.IsDir() && strings.HasPrefix(newKey, oldKey+string(filepath.Separator)) {
+		return linkErr(syscall.EINVAL)
+	}
+	if existing != nil {
+		switch {
+		case existing.mode.IsDir() && !n.mode.IsDir():
+			return linkErr(syscall.EISDIR)
+		case !existing.mode.IsDir() && n.mode.IsDir():
+			return linkErr(syscall.ENOTDIR)
+		case existing.mode.IsDir() && len(m.children(newKey)) > 0:
+			return linkErr(syscall.ENOTEMPTY)
+		}
+	}
+
+	if n.mode.IsDir() {
+		prefix := oldKey + string(filepath.Separator)
+		for name, child := range m.nodes {
+			if strings.HasPrefix(name, prefix) {
+				delete(m.nodes, name)
+				m.nodes[newKey+string(filepath.Separator)+name[len(prefix):]] = child
+			}
+		}
+	}
+	delete(m.nodes, oldKey)
+	m.nodes[newKey] = n
+	return nil
+}
+
+func (m *Mem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, n, _ := m.lookup(name, false)
+	switch {
+	case n == nil:
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	case n.mode.IsDir() && len(m.children(key)) > 0:
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	delete(m.nodes, key)
+	return nil
+}
+
+func (m *Mem) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup(name, true)
+	if err == nil && n == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	n.mode = n.mode&os.ModeType | mode.Perm()
+	return nil
+}
+
+func (m *Mem) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup(name, true)
+	if err == nil && n == nil {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return &os.PathError{Op: "chtimes", Path: name, Err: err}
+	}
+	n.modTime = mtime
+	return nil
+}
+
+func (m *Mem) Symlink(oldname, newname string) error {
+	return m.link("symlink", oldname, newname, func() (*inode, error) {
+		return &inode{mode: os.ModeSymlink | 0777, modTime: time.Now(), target: oldname}, nil
+	})
+}
+
+func (m *Mem) Link(oldname, newname string) error {
+	return m.link("link", oldname, newname, func() (*inode, error) {
+		_, n, _ := m.lookup(oldname, false)
+		switch {
+		case n == nil:
+			return nil, os.ErrNotExist
+		case n.mode.IsDir():
+			return nil, os.ErrPermission
+		}
+		return n, nil
+	})
+}
+
+func (m *Mem) link(op, oldname, newname string, node func() (*inode, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, existing, _ := m.lookup(newname, false)
+	if existing != nil {
+		return &os.LinkError{Op: op, Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	if err := m.parentDir(key); err != nil {
+		return &os.LinkError{Op: op, Old: oldname, New: newname, Err: err}
+	}
+	n, err := node()
+	if err != nil {
+		return &os.LinkError{Op: op, Old: oldname, New: newname, Err: err}
+	}
+	m.nodes[key] = n
+	return nil
+}
+
+func (m *Mem) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, _ := m.lookup(name, false)
+	switch {
+	case n == nil:
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrNotExist}
+	case n.mode&os.ModeSymlink == 0:
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return n.target, nil
+}
+
+func (n *inode) info(name string) os.FileInfo {
+	size := int64(len(n.data))
+	if n.mode&os.ModeSymlink != 0 {
+		size = int64(len(n.target))
+	}
+	return &memInfo{name: name, size: size, mode: n.mode, modTime: n.modTime}
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *memInfo) Name() string       { return fi.name }
+func (fi *memInfo) Size() int64        { return fi.size }
+func (fi *memInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memInfo) Sys() interface{}   { return nil }
+
+// memFile is an open handle on an inode.
+type memFile struct {
+	fs     *Mem
+	name   string
+	node   *inode
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (f *memFile) Name() string { return f.name }
+
+func (f *memFile) check(op string, write bool) error {
+	switch {
+	case f.closed:
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	case f.node.mode.IsDir():
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EISDIR}
+	case write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0:
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EBADF}
+	case !write && f.flag&os.O_WRONLY != 0:
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EBADF}
+	}
+	return nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	if end := f.offset + int64(len(p)); end > int64(len(f.node.data)) {
+		grown := make([]byte, end)
+		copy(grown, f.node.data)
+		f.node.data = grown
+	}
+	n := copy(f.node.data[f.offset:], p)
+	f.offset += int64(n)
+	f.node.modTime = time.Now()
+	return n, nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: os.ErrClosed}
+	}
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,298 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// overlay reads through to base but only ever writes to upper. Files are
+// copied up on their first modification and removed names are remembered so
+// base entries below them disappear from view.
+type overlay struct {
+	base    FS
+	upper   FS
+	mu      sync.Mutex
+	removed map[string]bool
+}
+
+// Overlay returns a filesystem showing base with every change made through it
+// applied to upper instead, base is left untouched. With NewMem as upper an
+// operation can run for real against a tree it must not modify, to preview
+// what it would do.
+func Overlay(base, upper FS) FS {
+	return &overlay{base: base, upper: upper, removed: make(map[string]bool)}
+}
+
+// hidden reports whether name, or a directory above it, was removed so base
+// no longer shows through.
+func (o *overlay) hidden(name string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for key := filepath.Clean(name); ; key = filepath.Dir(key) {
+		if o.removed[key] {
+			return true
+		}
+		if filepath.Dir(key) == key {
+			return false
+		}
+	}
+}
+
+func (o *overlay) hide(name string) {
+	o.mu.Lock()
+	o.removed[filepath.Clean(name)] = true
+	o.mu.Unlock()
+}
+
+func (o *overlay) inUpper(name string) bool {
+	_, err := o.upper.Lstat(name)
+	return err == nil
+}
+
+// copyUp makes name, when it only exists in base, a copy in upper so it can
+// be modified. Directories are copied with everything below them.
+func (o *overlay) copyUp(name string) error {
+	if o.inUpper(name) {
+		return nil
+	}
+	if o.hidden(name) {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	info, err := o.base.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if err := o.upperParent(name); err != nil {
+		return err
+	}
+
+	switch {
+	case info.IsDir():
+		if err := o.upper.MkdirAll(name, info.Mode().Perm()); err != nil {
+			return err
+		}
+		children, err := o.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := o.copyUp(filepath.Join(name, child.Name())); err != nil {
+				return err
+			}
+		}
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := o.base.Readlink(name)
+		if err != nil {
+			return err
+		}
+		return o.upper.Symlink(target, name)
+	default:
+		if err := o.copyFile(name, info); err != nil {
+			return err
+		}
+	}
+	return o.upper.Chtimes(name, info.ModTime(), info.ModTime())
+}
+
+func (o *overlay) copyFile(name string, info os.FileInfo) error {
+	in, err := o.base.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := o.upper.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// upperParent makes sure the directory holding name exists in upper when it
+// is visible in the overlay.
+func (o *overlay) upperParent(name string) error {
+	parent := filepath.Dir(filepath.Clean(name))
+	if o.inUpper(parent) {
+		return nil
+	}
+	info, err := o.Stat(parent)
+	if err != nil {
+		return err
+	}
+	return o.upper.MkdirAll(parent, info.Mode().Perm())
+}
+
+func (o *overlay) Open(name string) (File, error) {
+	return o.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (o *overlay) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		if o.inUpper(name) || o.hidden(name) {
+			return o.upper.OpenFile(name, flag, perm)
+		}
+		return o.base.OpenFile(name, flag, perm)
+	}
+
+	_, err := o.Lstat(name)
+	switch {
+	case err == nil && flag&os.O_TRUNC == 0:
+		if err := o.copyUp(name); err != nil {
+			return nil, err
+		}
+	case err == nil || os.IsNotExist(err):
+		if err := o.upperParent(name); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	return o.upper.OpenFile(name, flag, perm)
+}
+
+func (o *overlay) Stat(name string) (os.FileInfo, error) {
+	info, err := o.upper.Stat(name)
+	if err == nil || !os.IsNotExist(err) || o.hidden(name) {
+		return info, err
+	}
+	return o.base.Stat(name)
+}
+
+func (o *overlay) Lstat(name string) (os.FileInfo, error) {
+	info, err := o.upper.Lstat(name)
+	if err == nil || !os.IsNotExist(err) || o.hidden(name) {
+		return info, err
+	}
+	return o.base.Lstat(name)
+}
+
+func (o *overlay) ReadDir(name string) ([]os.FileInfo, error) {
+	merged := make(map[string]os.FileInfo)
+	upperInfos, upperErr := o.upper.ReadDir(name)
+	for _, info := range upperInfos {
+		merged[info.Name()] = info
+	}
+
+	var baseErr error = &os.PathError{Op: "readdir", Path: name, Err: os.ErrNotExist}
+	if !o.hidden(name) {
+		var baseInfos []os.FileInfo
+		baseInfos, baseErr = o.base.ReadDir(name)
+		for _, info := range baseInfos {
+			if _, ok := merged[info.Name()]; !ok && !o.hidden(filepath.Join(name, info.Name())) {
+				merged[info.Name()] = info
+			}
+		}
+	}
+	if upperErr != nil && baseErr != nil {
+		return nil, baseErr
+	}
+
+	infos := make([]os.FileInfo, 0, len(merged))
+	for _, info := range merged {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (o *overlay) MkdirAll(path string, perm os.FileMode) error {
+	if info, err := o.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	return o.upper.MkdirAll(path, perm)
+}
+
+func (o *overlay) Rename(oldpath, newpath string) error {
+	if err := o.copyUp(oldpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: underlying(err)}
+	}
+	if err := o.upperParent(newpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: underlying(err)}
+	}
+	if err := o.upper.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	o.hide(oldpath)
+	return nil
+}
+
+func (o *overlay) Remove(name string) error {
+	info, err := o.Lstat(name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: underlying(err)}
+	}
+	if info.IsDir() {
+		if children, _ := o.ReadDir(name); len(children) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	if o.inUpper(name) {
+		if err := o.upper.Remove(name); err != nil {
+			return err
+		}
+	}
+	o.hide(name)
+	return nil
+}
+
+func (o *overlay) Chmod(name string, mode os.FileMode) error {
+	if err := o.copyUp(name); err != nil {
+		return err
+	}
+	return o.upper.Chmod(name, mode)
+}
+
+func (o *overlay) Chtimes(name string, atime, mtime time.Time) error {
+	if err := o.copyUp(name); err != nil {
+		return err
+	}
+	return o.upper.Chtimes(name, atime, mtime)
+}
+
+func (o *overlay) Symlink(oldname, newname string) error {
+	if _, err := o.Lstat(newname); err == nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	if err := o.upperParent(newname); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: underlying(err)}
+	}
+	return o.upper.Symlink(oldname, newname)
+}
+
+func (o *overlay) Link(oldname, newname string) error {
+	if _, err := o.Lstat(newname); err == nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	if err := o.copyUp(oldname); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: underlying(err)}
+	}
+	if err := o.upperParent(newname); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: underlying(err)}
+	}
+	return o.upper.Link(oldname, newname)
+}
+
+func (o *overlay) Readlink(name string) (string, error) {
+	if o.inUpper(name) || o.hidden(name) {
+		return o.upper.Readlink(name)
+	}
+	return o.base.Readlink(name)
+}
+
+// underlying unwraps the error of a *os.PathError so it can be rewrapped.
+func underlying(err error) error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err
+	}
+	return err
+}
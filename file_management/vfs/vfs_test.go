@@ -0,0 +1,208 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// each runs test against every implementation, rooted at a fresh folder.
+func each(t *testing.T, test func(t *testing.T, fsys FS, root string)) {
+	t.Run("OS", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "vfs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		test(t, OS, dir)
+	})
+	t.Run("Mem", func(t *testing.T) {
+		test(t, NewMem(), "/root")
+	})
+	t.Run("Overlay", func(t *testing.T) {
+		base := NewMem()
+		if err := base.MkdirAll("/root", 0777); err != nil {
+			t.Fatal(err)
+		}
+		test(t, Overlay(base, NewMem()), "/root")
+	})
+}
+
+func write(t *testing.T, fsys FS, path, body string) {
+	t.Helper()
+	if err := fsys.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fsys, path, []byte(body), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, fsys FS, path string) string {
+	t.Helper()
+	b, err := ReadFile(fsys, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func names(t *testing.T, fsys FS, dir string) []string {
+	t.Helper()
+	infos, err := fsys.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := []string{}
+	for _, info := range infos {
+		found = append(found, info.Name())
+	}
+	sort.Strings(found)
+	return found
+}
+
+func TestRenameOverExistingFile(t *testing.T) {
+	each(t, func(t *testing.T, fsys FS, root string) {
+		a, b := filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt")
+		write(t, fsys, a, "a")
+		write(t, fsys, b, "b")
+		if err := fsys.Rename(a, b); err != nil {
+			t.Fatal(err)
+		}
+		if got := read(t, fsys, b); got != "a" {
+			t.Errorf("b.txt holds %q after the rename", got)
+		}
+		if _, err := fsys.Stat(a); !os.IsNotExist(err) {
+			t.Errorf("a.txt is still there: %v", err)
+		}
+
+		// A directory can't be renamed over a file.
+		dir := filepath.Join(root, "dir")
+		if err := fsys.MkdirAll(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.Rename(dir, b); err == nil {
+			t.Error("renamed a directory over a file")
+		}
+		if got := read(t, fsys, b); got != "a" {
+			t.Errorf("b.txt holds %q after the failed rename", got)
+		}
+	})
+}
+
+func TestRemoveNonEmptyDir(t *testing.T) {
+	each(t, func(t *testing.T, fsys FS, root string) {
+		dir := filepath.Join(root, "dir")
+		write(t, fsys, filepath.Join(dir, "a.txt"), "a")
+		if err := fsys.Remove(dir); err == nil {
+			t.Fatal("removed a directory that isn't empty")
+		}
+		if got := read(t, fsys, filepath.Join(dir, "a.txt")); got != "a" {
+			t.Errorf("a.txt holds %q", got)
+		}
+
+		if err := fsys.Remove(filepath.Join(dir, "a.txt")); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.Remove(dir); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fsys.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("dir is still there: %v", err)
+		}
+	})
+}
+
+func TestNotExist(t *testing.T) {
+	each(t, func(t *testing.T, fsys FS, root string) {
+		missing := filepath.Join(root, "missing")
+		below := filepath.Join(missing, "below")
+		now := time.Now()
+		ops := map[string]func() error{
+			"Open":     func() error { _, err := fsys.Open(missing); return err },
+			"OpenFile": func() error { _, err := fsys.OpenFile(missing, os.O_RDWR, 0); return err },
+			"Create":   func() error { _, err := Create(fsys, below); return err },
+			"Stat":     func() error { _, err := fsys.Stat(missing); return err },
+			"Lstat":    func() error { _, err := fsys.Lstat(missing); return err },
+			"ReadDir":  func() error { _, err := fsys.ReadDir(missing); return err },
+			"ReadFile": func() error { _, err := ReadFile(fsys, missing); return err },
+			"Rename":   func() error { return fsys.Rename(missing, filepath.Join(root, "other")) },
+			"Remove":   func() error { return fsys.Remove(missing) },
+			"Chmod":    func() error { return fsys.Chmod(missing, 0644) },
+			"Chtimes":  func() error { return fsys.Chtimes(missing, now, now) },
+			"Symlink":  func() error { return fsys.Symlink("target", below) },
+			"Link":     func() error { return fsys.Link(missing, filepath.Join(root, "other")) },
+			"Readlink": func() error { _, err := fsys.Readlink(missing); return err },
+			"Walk": func() error {
+				return Walk(fsys, missing, func(_ string, _ os.FileInfo, err error) error { return err })
+			},
+			"Stat below": func() error { _, err := fsys.Stat(below); return err },
+		}
+		for name, op := range ops {
+			if err := op(); !os.IsNotExist(err) {
+				t.Errorf("%s: got %v, want a not exist error", name, err)
+			}
+		}
+	})
+}
+
+func TestOverlayWhiteouts(t *testing.T) {
+	base := NewMem()
+	write(t, base, "/d/a.txt", "a")
+	write(t, base, "/d/b.txt", "b")
+	write(t, base, "/d/sub/c.txt", "c")
+	fsys := Overlay(base, NewMem())
+
+	// Removed base files disappear from view.
+	if err := fsys.Remove("/d/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("/d/a.txt"); !os.IsNotExist(err) {
+		t.Errorf("removed a.txt is still visible: %v", err)
+	}
+	if got := names(t, fsys, "/d"); !reflect.DeepEqual(got, []string{"b.txt", "sub"}) {
+		t.Errorf("/d lists %v", got)
+	}
+
+	// A new file of the same name shows through the whiteout.
+	write(t, fsys, "/d/a.txt", "new a")
+	if got := read(t, fsys, "/d/a.txt"); got != "new a" {
+		t.Errorf("a.txt holds %q", got)
+	}
+
+	// A renamed directory is gone from its old name, along with everything
+	// below it.
+	if err := fsys.Rename("/d/sub", "/d/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("/d/sub/c.txt"); !os.IsNotExist(err) {
+		t.Errorf("c.txt is still visible at its old name: %v", err)
+	}
+	if got := read(t, fsys, "/d/moved/c.txt"); got != "c" {
+		t.Errorf("moved c.txt holds %q", got)
+	}
+
+	// A base file renamed over another takes its place and leaves a
+	// whiteout behind.
+	if err := fsys.Rename("/d/b.txt", "/d/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, fsys, "/d/a.txt"); got != "b" {
+		t.Errorf("a.txt holds %q after the rename", got)
+	}
+	if got := names(t, fsys, "/d"); !reflect.DeepEqual(got, []string{"a.txt", "moved"}) {
+		t.Errorf("/d lists %v", got)
+	}
+
+	// Base didn't change at all.
+	if got := names(t, base, "/d"); !reflect.DeepEqual(got, []string{"a.txt", "b.txt", "sub"}) {
+		t.Errorf("base /d lists %v", got)
+	}
+	if got := read(t, base, "/d/a.txt"); got != "a" {
+		t.Errorf("base a.txt holds %q", got)
+	}
+}
@@ -0,0 +1,177 @@
+package watch
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/deckarep/gorganize/file_management/logging"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// watchMask is what a folder is watched for. Files are reported when created,
+// written or moved in, folders gone from under a watch drop it.
+const watchMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MODIFY | unix.IN_MOVED_TO |
+	unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+// notifier reports paths below the watched folders that changed, using
+// inotify.
+type notifier struct {
+	f    *os.File
+	fd   int
+	dirs map[int]string
+	skip func(path string) bool
+	log  logging.Logger
+}
+
+func newNotifier(skip func(path string) bool, log logging.Logger) (*notifier, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't start inotify")
+	}
+	// Non blocking, so reads go through the runtime poller and close
+	// interrupts them.
+	return &notifier{
+		f:    os.NewFile(uintptr(fd), "inotify"),
+		fd:   fd,
+		dirs: make(map[int]string),
+		skip: skip,
+		log:  log,
+	}, nil
+}
+
+// addTree watches root and every folder below it, returning the files found
+// on the way.
+func (n *notifier) addTree(root string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// Gone already or unreadable, nothing to watch.
+			n.log.Warnf("Couldn't watch %s: %s", path, err)
+			return nil
+		}
+		if n.skip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			return nil
+		}
+		wd, err := unix.InotifyAddWatch(n.fd, path, watchMask)
+		if err != nil {
+			if path == root {
+				return errors.Wrapf(err, "couldn't watch %s", path)
+			}
+			n.log.Warnf("Couldn't watch %s: %s", path, err)
+			return filepath.SkipDir
+		}
+		n.dirs[wd] = path
+		return nil
+	})
+	return files, err
+}
+
+// run sends changed paths to paths until the notifier is closed. New folders
+// are watched and their files sent as well.
+func (n *notifier) run(paths chan<- string) error {
+	buf := make([]byte, 64*1024)
+	for {
+		size, err := n.f.Read(buf)
+		if err != nil {
+			if isClosed(err) {
+				return nil
+			}
+			return errors.Wrap(err, "couldn't read inotify events")
+		}
+
+		for off := 0; off+unix.SizeofInotifyEvent <= size; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameBytes := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(event.Len)]
+			off += unix.SizeofInotifyEvent + int(event.Len)
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				// Events were lost, look at everything again.
+				n.log.Warnf("Too many changes at once, rescanning")
+				for _, dir := range n.roots() {
+					n.send(dir, paths)
+				}
+				continue
+			}
+
+			dir, ok := n.dirs[int(event.Wd)]
+			if !ok {
+				continue
+			}
+			if event.Mask&(unix.IN_IGNORED|unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0 {
+				delete(n.dirs, int(event.Wd))
+				unix.InotifyRmWatch(n.fd, uint32(event.Wd))
+				continue
+			}
+			if name == "" {
+				continue
+			}
+
+			path := filepath.Join(dir, name)
+			if n.skip(path) {
+				continue
+			}
+			if event.Mask&unix.IN_ISDIR != 0 {
+				if event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+					n.send(path, paths)
+				}
+				continue
+			}
+			paths <- path
+		}
+	}
+}
+
+// send watches the folder dir and sends every file in it.
+func (n *notifier) send(dir string, paths chan<- string) {
+	files, err := n.addTree(dir)
+	if err != nil {
+		n.log.Warnf("Couldn't watch %s: %s", dir, err)
+	}
+	for _, path := range files {
+		paths <- path
+	}
+}
+
+// roots are the watched folders not below another watched folder.
+func (n *notifier) roots() []string {
+	var roots []string
+	for _, dir := range n.dirs {
+		parent := filepath.Dir(dir)
+		watched := false
+		for _, other := range n.dirs {
+			if other == parent {
+				watched = true
+				break
+			}
+		}
+		if !watched {
+			roots = append(roots, dir)
+		}
+	}
+	return roots
+}
+
+func isClosed(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err == os.ErrClosed
+	}
+	return false
+}
+
+func (n *notifier) close() error {
+	return n.f.Close()
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package watch
+
+import (
+	"github.com/deckarep/gorganize/file_management/logging"
+	"github.com/pkg/errors"
+)
+
+// notifier needs inotify, elsewhere watching isn't supported yet.
+type notifier struct{}
+
+func newNotifier(skip func(path string) bool, log logging.Logger) (*notifier, error) {
+	return nil, errors.New("watching folders is only supported on Linux")
+}
+
+func (n *notifier) addTree(root string) ([]string, error) { return nil, nil }
+func (n *notifier) run(paths chan<- string) error         { return nil }
+func (n *notifier) close() error                          { return nil }
@@ -0,0 +1,271 @@
+// Package watch reports the files arriving in a folder once whoever is
+// writing them is done. Files are considered done when their size and
+// modification time stop changing, as scanners and phones give no other sign.
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/logging"
+	"github.com/deckarep/gorganize/file_management/tags"
+	"github.com/deckarep/gorganize/file_management/vfs"
+	"github.com/pkg/errors"
+)
+
+// StateFile is the default name of the file, inside the watched folder,
+// remembering which files were handled.
+const StateFile = ".gorganize-watch"
+
+// DefaultSettle is how long a file must stay unchanged by default.
+const DefaultSettle = 2 * time.Second
+
+// Options controls Watch.
+type Options struct {
+	// Settle is how long a file's size and modification time must stay the
+	// same before it is handled, it defaults to DefaultSettle.
+	Settle time.Duration
+	// State is where handled files are remembered between runs, it defaults
+	// to StateFile inside the watched folder.
+	State string
+	// Ignore are files and folders below the watched folder that are never
+	// handled, such as where the handler writes to. Folders holding the
+	// watched folder are left out.
+	Ignore []string
+	Logger logging.Logger
+}
+
+// Handler is called with files that are done being written, in batches. It
+// returns the files it handled, only those are remembered. The others are
+// tried again once they change or on the next Watch.
+type Handler func(ctx context.Context, paths []string) []string
+
+// Watch calls handle with every file below dir once it is done being written.
+// Files that arrived while nobody was watching are caught up on first: every
+// file not handled by a previous Watch, or changed since, goes through the
+// same settling as new ones. Folders created later are watched as well.
+// Watch returns nil once ctx is done and the batch being handled finished.
+func Watch(ctx context.Context, dir string, opts Options, handle Handler) error {
+	log := logging.Or(opts.Logger)
+	// Notifications only come from the operating system's file system.
+	fsys := vfs.OS
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.Wrap(err, "couldn't resolve watched folder")
+	}
+	if opts.Settle <= 0 {
+		opts.Settle = DefaultSettle
+	}
+	if opts.State == "" {
+		opts.State = filepath.Join(dir, StateFile)
+	}
+	var ignore []string
+	for _, path := range append([]string{opts.State, opts.State + ".gorganize-tmp"}, opts.Ignore...) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		// Ignoring a folder holding dir would ignore everything.
+		if abs == dir || strings.HasPrefix(dir, abs+string(filepath.Separator)) {
+			log.Warnf("Not ignoring %s, the watched folder is inside it", path)
+			continue
+		}
+		ignore = append(ignore, abs)
+	}
+	skip := func(path string) bool {
+		switch name := filepath.Base(path); {
+		case name == tags.FileName, strings.HasSuffix(name, ".gorganize-tmp"):
+			return true
+		}
+		for _, ig := range ignore {
+			if path == ig || strings.HasPrefix(path, ig+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	st, err := loadState(fsys, opts.State)
+	if err != nil {
+		return err
+	}
+
+	n, err := newNotifier(skip, log)
+	if err != nil {
+		return err
+	}
+
+	// Watches go up before the catch up scan so nothing slips in between.
+	existing, err := n.addTree(dir)
+	if err != nil {
+		n.close()
+		return err
+	}
+	log.Infof("Watching %s", dir)
+
+	events := make(chan string, 256)
+	go func() {
+		if err := n.run(events); err != nil {
+			log.Errorf("Stopped watching %s: %s", dir, err)
+		}
+		close(events)
+	}()
+	defer func() {
+		n.close()
+		// Unblocks the reader should it be waiting to send.
+		for range events {
+		}
+	}()
+
+	pending := make(map[string]*candidate)
+	consider := func(path string) {
+		info, err := fsys.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() || st.handled(dir, path, info) {
+			return
+		}
+		pending[path] = &candidate{size: info.Size(), modTime: info.ModTime(), since: time.Now()}
+	}
+	for _, path := range existing {
+		consider(path)
+	}
+	if len(pending) > 0 {
+		log.Infof("Catching up on %d file(s)", len(pending))
+	}
+
+	tick := opts.Settle / 4
+	if tick < 100*time.Millisecond {
+		tick = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("Stopped watching %s", dir)
+			return st.save(fsys, dir, opts.State)
+		case path, ok := <-events:
+			if !ok {
+				st.save(fsys, dir, opts.State)
+				return errors.Errorf("lost the watch on %s", dir)
+			}
+			consider(path)
+		case now := <-ticker.C:
+			ready := settled(fsys, pending, now, opts.Settle)
+			if len(ready) == 0 {
+				continue
+			}
+			for _, path := range handle(ctx, ready) {
+				if c, ok := pending[path]; ok {
+					st.add(dir, path, c)
+				}
+			}
+			for _, path := range ready {
+				delete(pending, path)
+			}
+			if err := st.save(fsys, dir, opts.State); err != nil {
+				log.Errorf("%s", err)
+			}
+		}
+	}
+}
+
+// candidate is a file waiting to settle.
+type candidate struct {
+	size    int64
+	modTime time.Time
+	// since is when the file last changed.
+	since time.Time
+}
+
+// settled returns the pending files unchanged for at least settle, sorted.
+// Files that went away are dropped.
+func settled(fsys vfs.FS, pending map[string]*candidate, now time.Time, settle time.Duration) []string {
+	var ready []string
+	for path, c := range pending {
+		info, err := fsys.Lstat(path)
+		if err != nil {
+			delete(pending, path)
+			continue
+		}
+		if info.Size() != c.size || !info.ModTime().Equal(c.modTime) {
+			c.size, c.modTime, c.since = info.Size(), info.ModTime(), now
+			continue
+		}
+		if now.Sub(c.since) >= settle {
+			ready = append(ready, path)
+		}
+	}
+	sort.Strings(ready)
+	return ready
+}
+
+// state is the files handled so far, by path relative to the watched folder.
+type state struct {
+	Files map[string]stateEntry `json:"files"`
+}
+
+type stateEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+func loadState(fsys vfs.FS, path string) (*state, error) {
+	st := &state{Files: make(map[string]stateEntry)}
+	b, err := vfs.ReadFile(fsys, path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read watch state")
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, errors.Wrapf(err, "corrupt watch state: %s", path)
+	}
+	if st.Files == nil {
+		st.Files = make(map[string]stateEntry)
+	}
+	return st, nil
+}
+
+// handled reports whether path was handled as it is now.
+func (st *state) handled(dir, path string, info os.FileInfo) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	e, ok := st.Files[filepath.ToSlash(rel)]
+	return ok && e.Size == info.Size() && e.ModTime.Equal(info.ModTime())
+}
+
+func (st *state) add(dir, path string, c *candidate) {
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		st.Files[filepath.ToSlash(rel)] = stateEntry{Size: c.size, ModTime: c.modTime}
+	}
+}
+
+// save writes the state, forgetting files that are gone, most of them were
+// moved away by the handler.
+func (st *state) save(fsys vfs.FS, dir, path string) error {
+	for rel := range st.Files {
+		if _, err := fsys.Lstat(filepath.Join(dir, filepath.FromSlash(rel))); os.IsNotExist(err) {
+			delete(st.Files, rel)
+		}
+	}
+
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode watch state")
+	}
+	tmp := path + ".gorganize-tmp"
+	if err := vfs.WriteFile(fsys, tmp, append(b, '\n'), 0666); err != nil {
+		fsys.Remove(tmp)
+		return errors.Wrap(err, "couldn't write watch state")
+	}
+	return errors.Wrap(fsys.Rename(tmp, path), "couldn't move watch state into place")
+}
@@ -0,0 +1,83 @@
+package watch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/deckarep/gorganize/file_management/vfs"
+)
+
+// run watches dir until handle has been called batches times, then returns
+// the files remembered as handled.
+func run(t *testing.T, dir string, batches int, handle Handler) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	calls := 0
+	err := Watch(ctx, dir, Options{Settle: 50 * time.Millisecond}, func(ctx context.Context, paths []string) []string {
+		handled := handle(ctx, paths)
+		if calls++; calls == batches {
+			cancel()
+		}
+		return handled
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != batches {
+		t.Fatalf("handler called %d times, want %d", calls, batches)
+	}
+
+	st, err := loadState(vfs.OS, filepath.Join(dir, StateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var remembered []string
+	for rel := range st.Files {
+		remembered = append(remembered, rel)
+	}
+	sort.Strings(remembered)
+	return remembered
+}
+
+func TestWatchRemembersOnlyHandledFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// b fails and the batch is cut short before c.
+	remembered := run(t, dir, 1, func(ctx context.Context, paths []string) []string {
+		if len(paths) != 3 {
+			t.Errorf("caught up on %v, want 3 files", paths)
+		}
+		return paths[:1]
+	})
+	if want := []string{"a.jpg"}; !reflect.DeepEqual(remembered, want) {
+		t.Errorf("remembered %v, want %v", remembered, want)
+	}
+
+	// The next run catches up on the files that weren't handled.
+	remembered = run(t, dir, 1, func(ctx context.Context, paths []string) []string {
+		want := []string{filepath.Join(dir, "b.jpg"), filepath.Join(dir, "c.jpg")}
+		if !reflect.DeepEqual(paths, want) {
+			t.Errorf("caught up on %v, want %v", paths, want)
+		}
+		return paths
+	})
+	if want := []string{"a.jpg", "b.jpg", "c.jpg"}; !reflect.DeepEqual(remembered, want) {
+		t.Errorf("remembered %v, want %v", remembered, want)
+	}
+}